@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/e-inwork-com/go-profile-service/internal/data"
+	"github.com/e-inwork-com/go-profile-service/internal/picture"
+	"github.com/google/uuid"
+)
+
+// defaultAvatarSize is the size in pixels of a PNG avatar without a size
+const defaultAvatarSize = 256
+
+var avatarNameRX = regexp.MustCompile(`^avatar-([0-9a-f-]{36})\.(png|svg)$`)
+
+// avatarName returns the file name of the generated avatar of a Profile
+func avatarName(profileID uuid.UUID, format string) string {
+	return fmt.Sprintf("avatar-%s.%s", profileID, format)
+}
+
+// parseAvatarName returns the Profile ID and the format of an avatar file name
+func parseAvatarName(name string) (uuid.UUID, string, bool) {
+	match := avatarNameRX.FindStringSubmatch(name)
+	if match == nil {
+		return uuid.Nil, "", false
+	}
+
+	id, err := uuid.Parse(match[1])
+	if err != nil {
+		return uuid.Nil, "", false
+	}
+
+	return id, match[2], true
+}
+
+// serveProfileAvatar sends an avatar with the initials of the Profile name
+// on a background color derived from the user ID. The avatar is generated
+// on every request, and the ETag is derived from the content.
+func (app *Application) serveProfileAvatar(w http.ResponseWriter, r *http.Request, profileID uuid.UUID, format string, size int, cacheControl string) {
+	// Get Profile from the database
+	profile, err := app.Models.Profiles.GetByID(profileID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if size == 0 {
+		size = defaultAvatarSize
+	}
+
+	initials := picture.Initials(profile.ProfileName)
+	background := picture.AvatarColor(profile.ProfileUser[:])
+
+	var buff bytes.Buffer
+	switch format {
+	case "svg":
+		buff.Write(picture.AvatarSVG(initials, background, size))
+		w.Header().Set("Content-Type", "image/svg+xml")
+	default:
+		img, err := picture.Avatar(initials, background, size)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = picture.Encode(&buff, img, "png")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+	}
+
+	hash := sha256.Sum256(buff.Bytes())
+	w.Header().Set("ETag", fmt.Sprintf("%q", hex.EncodeToString(hash[:16])))
+	w.Header().Set("Cache-Control", cacheControl)
+
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buff.Bytes()))
+}
@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/e-inwork-com/go-profile-service/internal/data"
 	"github.com/e-inwork-com/go-profile-service/internal/jsonlog"
@@ -27,6 +28,17 @@ func TestE2E(t *testing.T) {
 	cfg.Limiter.Rps = 2
 	cfg.Limiter.Burst = 6
 	cfg.Uploads = "../local/test/uploads"
+	cfg.Pictures.Variants = []int{64, 128, 512}
+	cfg.Pictures.Format = "jpeg"
+	cfg.Pictures.CacheControl = "public, max-age=31536000, immutable"
+	cfg.Pictures.AvatarCacheControl = "public, max-age=3600"
+	cfg.Pictures.MaxBytes = 10 << 20
+	cfg.Pictures.MaxWidth = 8192
+	cfg.Pictures.MaxHeight = 8192
+	cfg.Pictures.MaxPixels = 40_000_000
+	cfg.Pictures.History = 5
+	cfg.Pictures.ResizeSizes = []int{32, 64, 128}
+	cfg.Staging.TTL = time.Hour
 
 	// Logger
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
@@ -38,11 +50,25 @@ func TestE2E(t *testing.T) {
 	}
 	defer db.Close()
 
+	// Storage
+	store, err := OpenStorage(cfg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Staging
+	stage, err := OpenStaging(cfg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
 	// Application
 	app := Application{
-		Config: cfg,
-		Logger: logger,
-		Models: data.InitModels(db),
+		Config:  cfg,
+		Logger:  logger,
+		Models:  data.InitModels(db),
+		Storage: store,
+		Staging: stage,
 	}
 
 	// API Routes
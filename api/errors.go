@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 )
 
 func (app *Application) logError(r *http.Request, err error) {
@@ -83,3 +84,25 @@ func (app *Application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *Application) invalidSignatureResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the signature of the URL is missing, invalid or expired"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *Application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, limit int64) {
+	message := fmt.Sprintf("the request body must not be larger than %d bytes", limit)
+	app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
+func (app *Application) uploadOffsetConflictResponse(w http.ResponseWriter, r *http.Request, offset int64) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+
+	message := fmt.Sprintf("the offset of the upload is %d, resume the upload from this offset", offset)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *Application) tooManyUploadsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "too many active uploads, finish or delete an upload before starting another one"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/e-inwork-com/go-profile-service/internal/picture"
+	"github.com/e-inwork-com/go-profile-service/internal/storage"
+)
+
+// CollectGarbage deletes the stored pictures which are not referenced
+// by any Profile or picture history, together with their variants.
+// A file is only deleted after the grace period, because a new upload
+// is stored before the Profile is written to the database. With the
+// dry run the orphaned files are only logged. It returns the number
+// of orphaned files.
+func (app *Application) CollectGarbage(dryRun bool) (int, error) {
+	// List the files before reading the Profiles, so a picture
+	// which is added in between is never seen as an orphan
+	files, err := app.Storage.List()
+	if err != nil {
+		return 0, err
+	}
+
+	// The previous pictures are kept for a restore, the pictures
+	// of the Profiles and the history are read in one snapshot
+	pictures, err := app.Models.Profiles.GetAllPictures()
+	if err != nil {
+		return 0, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, name := range pictures {
+		referenced[name] = true
+	}
+
+	cutoff := time.Now().Add(-app.Config.GC.Grace)
+	orphans := 0
+
+	for _, file := range files {
+		if referenced[file.Name] || referenced[picture.BaseName(file.Name)] {
+			continue
+		}
+
+		if file.ModTime.After(cutoff) {
+			continue
+		}
+
+		orphans++
+
+		app.Logger.PrintInfo("orphaned picture", map[string]string{
+			"file":     file.Name,
+			"modified": file.ModTime.Format(time.RFC3339),
+			"dry_run":  strconv.FormatBool(dryRun),
+		})
+
+		if dryRun {
+			continue
+		}
+
+		err = app.Storage.Delete(file.Name)
+		if err != nil {
+			return orphans, err
+		}
+	}
+
+	// Remove the temporary files of the interrupted writes
+	if cleaner, ok := app.Storage.(storage.TempCleaner); ok && !dryRun {
+		removed, err := cleaner.CleanupTemp(cutoff)
+		if err != nil {
+			return orphans, err
+		}
+
+		app.Logger.PrintInfo("temporary files removed", map[string]string{
+			"files": strconv.Itoa(removed),
+		})
+	}
+
+	// Remove the expired resumable uploads
+	if app.Staging != nil && !dryRun {
+		expired, err := app.Staging.Cleanup()
+		if err != nil {
+			return orphans, err
+		}
+
+		app.Logger.PrintInfo("expired uploads removed", map[string]string{
+			"uploads": strconv.Itoa(expired),
+		})
+	}
+
+	app.Logger.PrintInfo("garbage collection completed", map[string]string{
+		"files":   strconv.Itoa(len(files)),
+		"orphans": strconv.Itoa(orphans),
+		"dry_run": strconv.FormatBool(dryRun),
+	})
+
+	return orphans, nil
+}
+
+// runGarbageCollector runs the garbage collection and the scan of the
+// pending pictures on every interval until the quit channel is closed
+func (app *Application) runGarbageCollector(quit <-chan struct{}) {
+	ticker := time.NewTicker(app.Config.GC.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err := app.CollectGarbage(false)
+			if err != nil {
+				app.Logger.PrintError(err, nil)
+			}
+
+			_, err = app.RescanPendingPictures()
+			if err != nil {
+				app.Logger.PrintError(err, nil)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/e-inwork-com/go-profile-service/internal/data"
+	"github.com/e-inwork-com/go-profile-service/internal/data/mocks"
+	"github.com/e-inwork-com/go-profile-service/internal/picture"
+	"github.com/e-inwork-com/go-profile-service/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	app := testApplication(t)
+	app.Config.GC.Grace = time.Hour
+
+	// An old orphan with a variant, and an orphan within the grace period
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"orphan.jpg", "orphan_64.jpg", "recent.jpg"} {
+		err := app.Storage.Put(name, bytes.NewReader([]byte(name)), int64(len(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"orphan.jpg", "orphan_64.jpg"} {
+		err := os.Chtimes(filepath.Join(app.Config.Uploads, name), old, old)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The picture of the mock Profile is referenced
+	referenced := mocks.MockFirstUUID().String() + ".jpg"
+	for _, name := range []string{referenced, picture.VariantName(referenced, 64)} {
+		err := os.Chtimes(filepath.Join(app.Config.Uploads, name), old, old)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A previous picture in the history is referenced
+	err := app.Storage.Put("history.jpg", bytes.NewReader([]byte("history")), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(filepath.Join(app.Config.Uploads, "history.jpg"), old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Models.PictureHistory.Insert(&data.PictureHistory{
+		ProfileID:      mocks.MockFirstUUID(),
+		ProfilePicture: "history.jpg",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Dry Run", func(t *testing.T) {
+		orphans, err := app.CollectGarbage(true)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, orphans)
+
+		_, err = app.Storage.Stat("orphan.jpg")
+		assert.Nil(t, err)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		orphans, err := app.CollectGarbage(false)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, orphans)
+
+		for _, name := range []string{"orphan.jpg", "orphan_64.jpg"} {
+			_, err = app.Storage.Stat(name)
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		}
+
+		for _, name := range []string{"recent.jpg", "history.jpg", referenced, picture.VariantName(referenced, 64)} {
+			_, err = app.Storage.Stat(name)
+			assert.Nil(t, err)
+		}
+	})
+}
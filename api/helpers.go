@@ -32,6 +32,18 @@ func (app *Application) readIDParam(r *http.Request) (uuid.UUID, error) {
 	return id, nil
 }
 
+// readUUIDParam get the request has a named param with valid UUID
+func (app *Application) readUUIDParam(r *http.Request, name string) (uuid.UUID, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := uuid.Parse(params.ByName(name))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid %s parameter", name)
+	}
+
+	return id, nil
+}
+
 // readFileParam get the request has a file param
 func (app *Application) readFileParam(r *http.Request) (string, error) {
 	// Get param from request
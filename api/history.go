@@ -0,0 +1,195 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/e-inwork-com/go-profile-service/internal/data"
+	"github.com/e-inwork-com/go-profile-service/internal/storage"
+	"github.com/e-inwork-com/go-profile-service/internal/validator"
+)
+
+// listPictureHistoryHandler function to list the previous pictures
+// of a Profile, the latest picture first
+func (app *Application) listPictureHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	profile, ok := app.readOwnProfile(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := app.Models.PictureHistory.GetAllByProfile(profile.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, entry := range entries {
+		entry.ProfilePictureURL, entry.ProfilePictureVariants = app.pictureURLs(entry.ProfilePicture)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"pictures": entries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restorePictureHistoryHandler function to set a previous picture
+// as the current picture of a Profile, the current picture
+// is moved to the history
+func (app *Application) restorePictureHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	profile, ok := app.readOwnProfile(w, r)
+	if !ok {
+		return
+	}
+
+	// Get the ID of the previous picture from the request parameters
+	historyID, err := app.readUUIDParam(r, "history")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	entry, err := app.Models.PictureHistory.GetByID(historyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The picture has to be in the history of this Profile
+	if entry.ProfileID != profile.ID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	v.Check(entry.ProfilePictureStatus != data.PictureStatusRejected, "history", "a rejected picture can't be restored")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Update the Profile with the previous picture
+	oldPicture, oldStatus := profile.ProfilePicture, profile.ProfilePictureStatus
+	profile.ProfilePicture = entry.ProfilePicture
+	profile.ProfilePictureStatus = entry.ProfilePictureStatus
+
+	// The placeholder metadata is not kept in the history
+	saved, err := app.readPictureMetadata(entry.ProfilePicture)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	saved.apply(profile)
+
+	err = app.updateProfilePicture(profile, oldPicture, oldStatus)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The restored picture is the current one now,
+	// and the old picture takes its place in the history
+	err = app.Models.PictureHistory.Delete(entry.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.logError(r, err)
+	}
+	app.retireProfilePicture(r, profile, oldPicture)
+	app.indexProfile(profile)
+
+	// A picture which hasn't been checked yet is scanned again
+	app.startPictureScan(profile)
+
+	// Send back the Profile to the request response
+	app.setProfilePictureURLs(profile)
+	err = app.writeJSON(w, http.StatusOK, envelope{"profile": profile}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateProfilePicture updates the Profile which has got a new picture.
+// The old picture is added to the history in the same transaction,
+// so it is always referenced by the Profile or the history.
+func (app *Application) updateProfilePicture(profile *data.Profile, oldPicture string, oldStatus string) error {
+	if oldPicture == "" || app.Config.Pictures.History <= 0 {
+		return app.Models.Profiles.Update(profile)
+	}
+
+	return app.Models.Profiles.UpdateWithHistory(profile, &data.PictureHistory{
+		ProfileID:            profile.ID,
+		ProfilePicture:       oldPicture,
+		ProfilePictureStatus: oldStatus,
+	})
+}
+
+// retireProfilePicture is called after updateProfilePicture has replaced
+// the picture of a Profile. The pictures beyond the retention of the history
+// are deleted. Without a history the old picture is deleted at once.
+func (app *Application) retireProfilePicture(r *http.Request, profile *data.Profile, oldPicture string) {
+	if oldPicture == "" {
+		return
+	}
+
+	if app.Config.Pictures.History <= 0 {
+		app.cleanupProfilePicture(r, oldPicture)
+		return
+	}
+
+	removed, err := app.Models.PictureHistory.Prune(profile.ID, app.Config.Pictures.History)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	for _, entry := range removed {
+		app.cleanupProfilePicture(r, entry.ProfilePicture)
+	}
+}
+
+// readOwnProfile gets the Profile of the request parameters, it sends
+// an error response and returns false if the Profile is not found
+// or the current user is not the owner
+func (app *Application) readOwnProfile(w http.ResponseWriter, r *http.Request) (*data.Profile, bool) {
+	// Get ID from the request parameters
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	// Get Profile from the database
+	profile, err := app.Models.Profiles.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	// Only the owner of the Profile can see and change its pictures
+	user := app.contextGetUser(r)
+	if profile.ProfileUser != user.ID {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return profile, true
+}
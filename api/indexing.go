@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/e-inwork-com/go-profile-service/internal/data"
+	"github.com/e-inwork-com/go-profile-service/internal/indexer"
+	"github.com/google/uuid"
+)
+
+// profileDocument returns the Solr document of a Profile,
+// the field names are the JSON tags of the Profile
+func profileDocument(profile *data.Profile, indexedAt time.Time) indexer.Document {
+	// The social links are a multivalued field of the URLs
+	links := make([]string, len(profile.ProfileSocialLinks))
+	for i, link := range profile.ProfileSocialLinks {
+		links[i] = link.URL
+	}
+
+	return indexer.Document{
+		"id":                         profile.ID.String(),
+		"created_at_dt":              profile.CreatedAt.UTC().Format(time.RFC3339),
+		"profile_user_s":             profile.ProfileUser.String(),
+		"profile_name_t":             profile.ProfileName,
+		"profile_picture_s":          profile.ProfilePicture,
+		"profile_picture_status_s":   profile.ProfilePictureStatus,
+		"profile_picture_blurhash_s": profile.ProfilePictureBlurhash,
+		"profile_picture_color_s":    profile.ProfilePictureColor,
+		"profile_headline_t":         profile.ProfileHeadline,
+		"profile_bio_t":              profile.ProfileBio,
+		"profile_location_t":         profile.ProfileLocation,
+		"profile_website_s":          profile.ProfileWebsite,
+		"profile_social_links_ss":    links,
+		"indexed_at_dt":              indexedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// indexProfile queues the Profile to be sent to Solr
+// after it has been saved in the database
+func (app *Application) indexProfile(profile *data.Profile) {
+	if app.Indexer == nil {
+		return
+	}
+
+	app.Indexer.Add(profileDocument(profile, time.Now()))
+}
+
+// unindexProfile queues the Profile to be deleted from Solr
+func (app *Application) unindexProfile(id uuid.UUID) {
+	if app.Indexer == nil {
+		return
+	}
+
+	app.Indexer.Delete(id.String())
+}
+
+// FlushIndexer sends the queued Profiles to Solr at once, a command
+// which changes the Profiles must call it before the process exits
+func (app *Application) FlushIndexer() error {
+	if app.Indexer == nil {
+		return nil
+	}
+
+	return app.Indexer.Flush(context.Background())
+}
+
+// runIndexer sends the queued Profiles to Solr until the quit channel is closed
+func (app *Application) runIndexer(quit <-chan struct{}) {
+	app.Indexer.Run(quit, func(err error) {
+		app.Logger.PrintError(err, map[string]string{
+			"pending": strconv.Itoa(app.Indexer.Pending()),
+		})
+	})
+}
+
+// Reindex sends all the Profiles to Solr, and then deletes the documents
+// which haven't been sent, such as the documents of the deleted Profiles.
+// The collection keeps the old documents while it is rebuilt.
+// It returns the number of the indexed Profiles.
+func (app *Application) Reindex() (int, error) {
+	started := time.Now()
+
+	// The keyset of the last Profile of the previous page
+	var createdAt time.Time
+	var id uuid.UUID
+
+	indexed := 0
+	for {
+		profiles, err := app.Models.Profiles.GetAllAfter(createdAt, id, app.Indexer.BatchSize)
+		if err != nil {
+			return indexed, err
+		}
+
+		if len(profiles) == 0 {
+			break
+		}
+
+		for _, profile := range profiles {
+			app.Indexer.Add(profileDocument(profile, started))
+		}
+
+		err = app.Indexer.Flush(context.Background())
+		if err != nil {
+			return indexed, err
+		}
+		indexed += len(profiles)
+
+		last := profiles[len(profiles)-1]
+		createdAt, id = last.CreatedAt, last.ID
+	}
+
+	// The documents of this run have the start time or later
+	query := "indexed_at_dt:[* TO " + started.UTC().Format(time.RFC3339Nano) + "}"
+	err := app.Indexer.Solr.DeleteByQuery(context.Background(), query)
+	if err != nil {
+		return indexed, err
+	}
+
+	err = app.Indexer.Solr.Commit(context.Background())
+	if err != nil {
+		return indexed, err
+	}
+
+	app.Logger.PrintInfo("profiles reindexed", map[string]string{
+		"profiles": strconv.Itoa(indexed),
+	})
+
+	return indexed, nil
+}
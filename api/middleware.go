@@ -104,10 +104,13 @@ func (app *Application) enableCORS(next http.Handler) http.Handler {
 				if origin == app.Config.Cors.TrustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 
+					// The resumable uploads send and read the offset
+					w.Header().Set("Access-Control-Expose-Headers", "Location, Upload-Offset")
+
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Upload-Offset")
 
 						w.WriteHeader(http.StatusOK)
 						return
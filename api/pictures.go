@@ -0,0 +1,502 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/e-inwork-com/go-profile-service/internal/data"
+	"github.com/e-inwork-com/go-profile-service/internal/picture"
+	"github.com/e-inwork-com/go-profile-service/internal/validator"
+)
+
+// parseProfileForm reads the multipart form of a Profile request,
+// the size of the body is limited before anything is read
+func (app *Application) parseProfileForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, app.Config.Pictures.MaxBytes)
+
+	err := r.ParseMultipartForm(app.Config.Pictures.MaxBytes)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+
+	return nil
+}
+
+// pictureUpload is an uploaded picture with an optional crop rectangle
+type pictureUpload struct {
+	data []byte
+	crop image.Rectangle
+}
+
+// readProfilePicture reads the uploaded picture of the form, it returns
+// nil if there is no picture. The type and the dimensions of the image
+// are checked before the pixels are decoded.
+func (app *Application) readProfilePicture(r *http.Request, v *validator.Validator) (*pictureUpload, error) {
+	// Read a file attachment
+	file, _, err := r.FormFile("profile_picture_s")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+			// A crop rectangle needs a picture
+			if hasCropFields(r) {
+				v.AddError("crop_x", "must be sent with profile_picture_s")
+			}
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	buff, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.checkProfilePicture(r, v, buff), nil
+}
+
+// checkProfilePicture checks the type and the dimensions of an uploaded
+// picture and reads the crop rectangle of the form, it returns nil if the
+// picture is not valid
+func (app *Application) checkProfilePicture(r *http.Request, v *validator.Validator, buff []byte) *pictureUpload {
+	// Check type of file
+	filetype := http.DetectContentType(buff)
+	if !validator.In(filetype, "image/jpeg", "image/png", "image/webp", "image/gif") {
+		v.AddError("profile_picture_s", "must be a JPEG, PNG, WebP or GIF image")
+		return nil
+	}
+
+	// Check the dimensions from the header of the image,
+	// so a decompression bomb is never decoded
+	config, _, err := picture.DecodeConfig(buff)
+	if err != nil {
+		v.AddError("profile_picture_s", "must be a valid image")
+		return nil
+	}
+
+	limits := app.Config.Pictures
+	v.Check(config.Width <= limits.MaxWidth, "profile_picture_s", fmt.Sprintf("must not be wider than %d pixels", limits.MaxWidth))
+	v.Check(config.Height <= limits.MaxHeight, "profile_picture_s", fmt.Sprintf("must not be higher than %d pixels", limits.MaxHeight))
+	v.Check(int64(config.Width)*int64(config.Height) <= limits.MaxPixels, "profile_picture_s", fmt.Sprintf("must not have more than %d pixels", limits.MaxPixels))
+
+	upload := &pictureUpload{data: buff}
+
+	// Read the crop rectangle in the pixels of the upright image
+	if hasCropFields(r) {
+		upload.crop = app.readCrop(r, v, config.Width, config.Height)
+	}
+
+	return upload
+}
+
+// hasCropFields checks if any of the crop fields is in the form
+func hasCropFields(r *http.Request) bool {
+	for _, key := range []string{"crop_x", "crop_y", "crop_width", "crop_height"} {
+		if r.PostForm.Get(key) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readCrop reads the crop rectangle of the form,
+// and checks it against the bounds of the image
+func (app *Application) readCrop(r *http.Request, v *validator.Validator, width int, height int) image.Rectangle {
+	x := app.readInt(r.PostForm, "crop_x", -1, v)
+	y := app.readInt(r.PostForm, "crop_y", -1, v)
+	w := app.readInt(r.PostForm, "crop_width", -1, v)
+	h := app.readInt(r.PostForm, "crop_height", -1, v)
+
+	v.Check(x >= 0, "crop_x", "must be provided and not negative")
+	v.Check(y >= 0, "crop_y", "must be provided and not negative")
+	v.Check(w > 0, "crop_width", "must be provided and greater than zero")
+	v.Check(h > 0, "crop_height", "must be provided and greater than zero")
+	if !v.Valid() {
+		return image.Rectangle{}
+	}
+
+	// Compare without adding, so a huge offset and size can't overflow
+	v.Check(w <= width-x, "crop_width", fmt.Sprintf("must fit within the image width of %d pixels", width))
+	v.Check(h <= height-y, "crop_height", fmt.Sprintf("must fit within the image height of %d pixels", height))
+
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// savedPicture is a picture in the storage, with the metadata
+// of a placeholder which is shown while the picture is loading
+type savedPicture struct {
+	name     string
+	blurhash string
+	color    string
+}
+
+// apply sets the picture on the Profile
+func (p *savedPicture) apply(profile *data.Profile) {
+	profile.ProfilePicture = p.name
+	profile.ProfilePictureBlurhash = p.blurhash
+	profile.ProfilePictureColor = p.color
+}
+
+// saveProfilePicture saves the uploaded picture to the storage,
+// together with a square variant for every configured size,
+// and returns the new file name of the picture.
+// The picture is encoded again from the pixels in the canonical format,
+// so the metadata of the upload, such as a GPS location, is never stored.
+func (app *Application) saveProfilePicture(upload *pictureUpload) (*savedPicture, error) {
+	img, _, err := picture.Decode(upload.data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Crop before the variants are created
+	if !upload.crop.Empty() {
+		img = picture.Crop(img, upload.crop)
+	}
+
+	format := app.Config.Pictures.Format
+
+	var original bytes.Buffer
+	err = picture.Encode(&original, img, format)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := picture.NewName(original.Bytes(), format)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.Storage.Put(name, &original, int64(original.Len()))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, variant := range app.Config.Pictures.Variants {
+		err = app.putPicture(picture.VariantName(name, variant), picture.Square(img, variant), format)
+		if err != nil {
+			// Don't leave an incomplete set of files behind
+			app.deleteProfilePicture(name)
+			return nil, err
+		}
+	}
+
+	return &savedPicture{
+		name:     name,
+		blurhash: picture.Blurhash(img),
+		color:    picture.DominantColor(img),
+	}, nil
+}
+
+// readPictureMetadata computes the placeholder metadata
+// of a picture which is already in the storage
+func (app *Application) readPictureMetadata(name string) (*savedPicture, error) {
+	file, _, err := app.Storage.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buff, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := picture.Decode(buff)
+	if err != nil {
+		return nil, err
+	}
+
+	return &savedPicture{
+		name:     name,
+		blurhash: picture.Blurhash(img),
+		color:    picture.DominantColor(img),
+	}, nil
+}
+
+// putPicture encodes the image and saves it to the storage
+func (app *Application) putPicture(name string, img image.Image, format string) error {
+	var buff bytes.Buffer
+	err := picture.Encode(&buff, img, format)
+	if err != nil {
+		return err
+	}
+
+	return app.Storage.Put(name, &buff, int64(buff.Len()))
+}
+
+// deleteProfilePicture deletes the picture and its variants from the storage
+func (app *Application) deleteProfilePicture(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	err := app.Storage.Delete(name)
+	if err != nil {
+		return err
+	}
+
+	for _, variant := range app.Config.Pictures.Variants {
+		err = app.Storage.Delete(picture.VariantName(name, variant))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cleanupProfilePicture deletes a picture which is not referenced
+// by a Profile, an error is only logged because the response
+// of the request doesn't depend on it
+func (app *Application) cleanupProfilePicture(r *http.Request, name string) {
+	err := app.deleteProfilePicture(name)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// isPictureVariant checks if the size is one of the configured variants
+func (app *Application) isPictureVariant(size int) bool {
+	for _, variant := range app.Config.Pictures.Variants {
+		if size == variant {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setProfilePictureURLs sets the URLs of the picture and its variants
+// on the Profile response, a Profile without a picture gets the URLs
+// of a generated avatar
+func (app *Application) setProfilePictureURLs(profile *data.Profile) {
+	name := profile.ProfilePicture
+	if name == "" {
+		name = avatarName(profile.ID, "png")
+
+		// The background of the avatar is the dominant color
+		profile.ProfilePictureColor = picture.HexColor(picture.AvatarColor(profile.ProfileUser[:]))
+	}
+
+	profile.ProfilePictureURL, profile.ProfilePictureVariants = app.pictureURLs(name)
+}
+
+// pictureURLs returns the URL of the picture, and the URLs
+// of its variants by the size
+func (app *Application) pictureURLs(name string) (string, map[string]string) {
+	variants := make(map[string]string)
+	for _, variant := range app.Config.Pictures.Variants {
+		variants[strconv.Itoa(variant)] = app.pictureURL(name, variant)
+	}
+
+	return app.pictureURL(name, 0), variants
+}
+
+// pictureURL returns the path of the picture endpoint,
+// the size 0 is the original picture
+func (app *Application) pictureURL(name string, size int) string {
+	return app.signedPictureURL(name, pictureParams(size, 0, 0, ""))
+}
+
+// resizedPictureURL returns the path of the picture endpoint
+// which resizes the picture on demand
+func (app *Application) resizedPictureURL(name string, width, height int, fit string) string {
+	return app.signedPictureURL(name, pictureParams(0, width, height, fit))
+}
+
+// pictureParams returns the query parameters which select the size of a picture,
+// a resize has all of w, h and fit so the signed parameters are unambiguous
+func pictureParams(size, width, height int, fit string) url.Values {
+	params := url.Values{}
+	if size != 0 {
+		params.Set("size", strconv.Itoa(size))
+	}
+
+	if width != 0 || height != 0 {
+		params.Set("w", strconv.Itoa(width))
+		params.Set("h", strconv.Itoa(height))
+		params.Set("fit", fit)
+	}
+
+	return params
+}
+
+// signedPictureURL returns the path of the picture endpoint with the parameters
+func (app *Application) signedPictureURL(name string, params url.Values) string {
+	path := fmt.Sprintf("/service/profiles/pictures/%s", url.PathEscape(name))
+
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+
+	// Sign the URL, so the picture can be served
+	// without an Authorization header
+	if app.Config.Pictures.Signing.Enabled {
+		// The expiry is rounded to the TTL, so the URL doesn't change on every
+		// request and the browsers can cache it, a URL is valid for at least one TTL
+		ttl := app.Config.Pictures.Signing.TTL
+		expires := time.Now().Truncate(ttl).Add(2 * ttl).Unix()
+
+		query.Set("expires", strconv.FormatInt(expires, 10))
+		query.Set("signature", app.signPicture(name, params, expires))
+	}
+
+	if len(query) == 0 {
+		return path
+	}
+
+	return path + "?" + query.Encode()
+}
+
+// signPicture returns the HMAC signature of a picture URL,
+// it covers the name, the size parameters and the expiry
+func (app *Application) signPicture(name string, params url.Values, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(app.Config.Pictures.Signing.Secret))
+	fmt.Fprintf(mac, "%s:%s:%d", name, params.Encode(), expires)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyPictureSignature checks the signature and the expiry of a picture URL,
+// and returns the time left until the URL expires
+func (app *Application) verifyPictureSignature(qs url.Values, name string, params url.Values) (time.Duration, bool) {
+	expires, err := strconv.ParseInt(qs.Get("expires"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	signature, err := hex.DecodeString(qs.Get("signature"))
+	if err != nil {
+		return 0, false
+	}
+
+	expected, _ := hex.DecodeString(app.signPicture(name, params, expires))
+	if !hmac.Equal(signature, expected) {
+		return 0, false
+	}
+
+	left := time.Until(time.Unix(expires, 0))
+	if left <= 0 {
+		return 0, false
+	}
+
+	return left, true
+}
+
+// MigratePictures renames the pictures of all profiles which were
+// stored before the names were derived from the content. Every picture
+// is processed again like a new upload, so the metadata is removed and
+// the variants are created, and the old files are deleted after the
+// profile has been updated.
+func (app *Application) MigratePictures() error {
+	profiles, err := app.Models.Profiles.GetAllWithPicture()
+	if err != nil {
+		return err
+	}
+
+	migrated := 0
+	for _, profile := range profiles {
+		if picture.IsContentName(profile.ProfilePicture) {
+			continue
+		}
+
+		err = app.migratePicture(profile)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"profile": profile.ID.String(),
+				"picture": profile.ProfilePicture,
+			})
+			continue
+		}
+
+		migrated++
+	}
+
+	app.Logger.PrintInfo("pictures migrated", map[string]string{
+		"migrated": strconv.Itoa(migrated),
+		"profiles": strconv.Itoa(len(profiles)),
+	})
+
+	return nil
+}
+
+// migratePicture stores the picture of the profile under a new name
+func (app *Application) migratePicture(profile *data.Profile) error {
+	file, _, err := app.Storage.Get(profile.ProfilePicture)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buff, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	saved, err := app.saveProfilePicture(&pictureUpload{data: buff})
+	if err != nil {
+		return err
+	}
+
+	old := profile.ProfilePicture
+	saved.apply(profile)
+
+	err = app.Models.Profiles.Update(profile)
+	if err != nil {
+		app.deleteProfilePicture(saved.name)
+		return err
+	}
+	app.indexProfile(profile)
+
+	return app.deleteProfilePicture(old)
+}
+
+// BackfillPictureMetadata computes the placeholder metadata of the pictures
+// which have been stored before the metadata was computed on upload
+func (app *Application) BackfillPictureMetadata() error {
+	profiles, err := app.Models.Profiles.GetAllWithPicture()
+	if err != nil {
+		return err
+	}
+
+	backfilled := 0
+	for _, profile := range profiles {
+		if profile.ProfilePictureBlurhash != "" {
+			continue
+		}
+
+		saved, err := app.readPictureMetadata(profile.ProfilePicture)
+		if err == nil {
+			saved.apply(profile)
+			err = app.Models.Profiles.Update(profile)
+		}
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"profile": profile.ID.String(),
+				"picture": profile.ProfilePicture,
+			})
+			continue
+		}
+		app.indexProfile(profile)
+
+		backfilled++
+	}
+
+	app.Logger.PrintInfo("picture metadata backfilled", map[string]string{
+		"backfilled": strconv.Itoa(backfilled),
+		"profiles":   strconv.Itoa(len(profiles)),
+	})
+
+	return nil
+}
@@ -1,111 +1,98 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strings"
 
 	"github.com/e-inwork-com/go-profile-service/internal/data"
+	"github.com/e-inwork-com/go-profile-service/internal/picture"
+	"github.com/e-inwork-com/go-profile-service/internal/storage"
 	"github.com/e-inwork-com/go-profile-service/internal/validator"
+	"github.com/google/uuid"
 )
 
 // Function to create a Profile
 func (app *Application) createProfileHandler(w http.ResponseWriter, r *http.Request) {
+	// Read the form with a limit on the size of the upload
+	err := app.parseProfileForm(w, r)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.payloadTooLargeResponse(w, r, maxBytesError.Limit)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
 	// Get a profile name
 	profileName := r.FormValue("profile_name_t")
 
-	// Read a file attachment
-	file, fileHeader, err := r.FormFile("profile_picture_s")
-	if err == nil {
-		defer file.Close()
-	}
-
 	// Get the current user
 	user := app.contextGetUser(r)
 
-	// Set profile picture
-	profilePicture := ""
-	if file != nil {
-		profilePicture = fmt.Sprintf("%s%s", user.ID.String(), filepath.Ext(fileHeader.Filename))
-	}
-
 	// Set Profile
 	profile := &data.Profile{
-		ProfileUser:    user.ID,
-		ProfileName:    profileName,
-		ProfilePicture: profilePicture,
+		ProfileUser: user.ID,
+		ProfileName: profileName,
 	}
 
-	// Validate Profile
+	// Read the details and check a file attachment
 	v := validator.New()
-	if data.ValidateProfile(v, profile); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	app.readProfileDetails(r, profile, v)
+	upload, err := app.readProfilePicture(r, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Check type of file
-	if profilePicture != "" {
-		buff := make([]byte, 512)
-		_, err = file.Read(buff)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
-		}
-
-		filetype := http.DetectContentType(buff)
-		if filetype != "image/jpeg" && filetype != "image/png" {
-			http.Error(w, "Please upload a JPEG or PNG image", http.StatusBadRequest)
-			return
-		}
-
-		// Read a file from the beginning offset
-		_, err = file.Seek(0, io.SeekStart)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
-		}
-
-		// Create an uploading folder if it doesn't
-		// already exist
-		err = os.MkdirAll(app.Config.Uploads, os.ModePerm)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
-		}
-
-		// Create a new file in the uploads directory
-		dst, err := os.Create(fmt.Sprintf("%s/%s", app.Config.Uploads, profilePicture))
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
-		}
-
-		defer dst.Close()
+	// Validate Profile
+	data.ValidateProfile(v, profile)
+	if data.ValidateAttributes(v, app.Attributes, profile.Attributes); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
-		// Copy the uploaded file to the filesystem
-		// at the specified destination
-		_, err = io.Copy(dst, file)
+	if upload != nil {
+		// Save the uploaded picture with the variants to the storage,
+		// the name of the file is derived from the content
+		saved, err := app.saveProfilePicture(upload)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
 		}
+		saved.apply(profile)
+		profile.ProfilePictureStatus = app.newPictureStatus()
 	}
 
 	// Insert data to Profile
 	err = app.Models.Profiles.Insert(profile)
 	if err != nil {
+		// The new picture is not used by any Profile
+		app.cleanupProfilePicture(r, profile.ProfilePicture)
+
 		switch {
+		case errors.Is(err, data.ErrDuplicateUser):
+			v.AddError("profile_user_s", "a profile for this user already exists")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	// Send the new Profile to Solr, and check
+	// the new picture with the content scanner
+	app.indexProfile(profile)
+	app.startPictureScan(profile)
+
 	// Send a Profile data as response of the HTTP request
+	app.setProfilePictureURLs(profile)
 	err = app.writeJSON(w, http.StatusCreated, envelope{"profile": profile}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -132,12 +119,186 @@ func (app *Application) getProfileHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// Send a request response
+	app.setProfilePictureURLs(profile)
 	err = app.writeJSON(w, http.StatusOK, envelope{"profile": profile}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// getProfileByIDHandler function to get a Profile by ID. The owner
+// of the Profile and the admins get the full Profile, and the other
+// users get the public projection, even without an authentication.
+func (app *Application) getProfileByIDHandler(w http.ResponseWriter, r *http.Request) {
+	// Get ID from the request parameters
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Get Profile from the database
+	profile, err := app.Models.Profiles.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.setProfilePictureURLs(profile)
+
+	// Send a request response with the fields the user may see
+	user := app.contextGetUser(r)
+	err = app.writeJSON(w, http.StatusOK, envelope{"profile": app.profileView(user, profile)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listProfilesHandler function to get a page of the Profiles,
+// they can be filtered by a part of the name or by the IDs
+func (app *Application) listProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ProfileName string
+		IDs         []uuid.UUID
+		data.Filters
+	}
+
+	v := validator.New()
+
+	// Read the filters from the query string
+	qs := r.URL.Query()
+
+	input.ProfileName = app.readString(qs, "profile_name_t", "")
+
+	ids := app.readCSV(qs, "ids", []string{})
+	for _, field := range ids {
+		id, err := uuid.Parse(field)
+		if err != nil {
+			v.AddError("ids", "must be a comma separated list of profile IDs")
+			break
+		}
+		input.IDs = append(input.IDs, id)
+	}
+	v.Check(len(ids) <= 100, "ids", "must not contain more than 100 IDs")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "profile_name_t")
+	input.Filters.SortSafelist = []string{"created_at_dt", "profile_name_t", "-created_at_dt", "-profile_name_t"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	profiles, metadata, err := app.Models.Profiles.GetAll(input.ProfileName, input.IDs, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Every Profile has the fields the user may see
+	user := app.contextGetUser(r)
+	views := make([]interface{}, len(profiles))
+	for i, profile := range profiles {
+		app.setProfilePictureURLs(profile)
+		views[i] = app.profileView(user, profile)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"profiles": views, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// searchProfilesHandler function to find the Profiles by a full-text
+// and fuzzy search on the names, ranked by the relevance of the match
+func (app *Application) searchProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	// Read the query and the filters from the query string
+	qs := r.URL.Query()
+
+	input.Query = strings.TrimSpace(app.readString(qs, "q", ""))
+	v.Check(input.Query != "", "q", "must be provided")
+	v.Check(len(input.Query) <= 100, "q", "must not be more than 100 bytes long")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-rank")
+	input.Filters.SortSafelist = []string{"-rank", "created_at_dt", "profile_name_t", "-created_at_dt", "-profile_name_t"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	matches, metadata, err := app.Models.Profiles.Search(input.Query, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Every result has the fields the user may see, with the words
+	// of the searched fields matching the query marked
+	user := app.contextGetUser(r)
+	terms := data.SearchTerms(input.Query)
+	results := make([]envelope, len(matches))
+	for i, match := range matches {
+		app.setProfilePictureURLs(match.Profile)
+		results[i] = envelope{
+			"profile": app.profileView(user, match.Profile),
+			"rank":    match.Rank,
+			"highlight": envelope{
+				"profile_name_t":     data.Highlight(match.Profile.ProfileName, terms),
+				"profile_headline_t": data.Highlight(match.Profile.ProfileHeadline, terms),
+				"profile_bio_t":      data.Highlight(match.Profile.ProfileBio, terms),
+				"profile_location_t": data.Highlight(match.Profile.ProfileLocation, terms),
+			},
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// profileView returns the full Profile for the owner and the admins,
+// and the public projection of the Profile for the other users
+func (app *Application) profileView(user *data.User, profile *data.Profile) interface{} {
+	if profile.ProfileUser == user.ID || app.isAdmin(user) {
+		return profile
+	}
+
+	return profile.Public()
+}
+
+// isAdmin checks if the user is one of the configured admins
+func (app *Application) isAdmin(user *data.User) bool {
+	if user.IsAnonymous() {
+		return false
+	}
+
+	for _, id := range app.Config.Auth.Admins {
+		if user.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
 // patchProfileHandler function to update a Profile record
 func (app *Application) patchProfileHandler(w http.ResponseWriter, r *http.Request) {
 	// Get ID from the request parameters
@@ -169,94 +330,225 @@ func (app *Application) patchProfileHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Read the form with a limit on the size of the upload
+	err = app.parseProfileForm(w, r)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.payloadTooLargeResponse(w, r, maxBytesError.Limit)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
 	// Get a profile name
 	profileName := r.FormValue("profile_name_t")
 
-	// Read a file attachment
-	file, fileHeader, err := r.FormFile("profile_picture_s")
-	if err == nil {
-		defer file.Close()
+	// Read and check a file attachment
+	v := validator.New()
+	upload, err := app.readProfilePicture(r, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
-	// Set profile picture
-	profilePicture := ""
-	if file != nil {
-		profilePicture = fmt.Sprintf("%s%s", user.ID.String(), filepath.Ext(fileHeader.Filename))
+	// Only the details in the form are changed
+	app.readProfileDetails(r, profile, v)
+	data.ValidateProfile(v, profile)
+	if data.ValidateAttributes(v, app.Attributes, profile.Attributes); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
 	// Set a new Profile
 	newProfile := &data.Profile{
-		ProfileName:    profileName,
-		ProfilePicture: profilePicture,
+		ProfileName: profileName,
 	}
 
-	if profilePicture != "" {
-		// Check type of file
-		buff := make([]byte, 512)
-		_, err = file.Read(buff)
+	if upload != nil {
+		// Save the uploaded picture with the variants to the storage,
+		// the name of the file is derived from the content
+		saved, err := app.saveProfilePicture(upload)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
 		}
+		saved.apply(newProfile)
+	}
 
-		filetype := http.DetectContentType(buff)
-		if filetype != "image/jpeg" && filetype != "image/png" {
-			http.Error(w, "Please upload a JPEG or PNG image", http.StatusBadRequest)
-			return
-		}
+	// Update the old profile picture with a new one
+	if newProfile.ProfileName != "" {
+		profile.ProfileName = newProfile.ProfileName
+	}
 
-		// Read a file from the beginning offset
-		_, err = file.Seek(0, io.SeekStart)
-		if err != nil {
+	oldPicture, oldStatus := "", ""
+	if newProfile.ProfilePicture != "" {
+		oldPicture, oldStatus = profile.ProfilePicture, profile.ProfilePictureStatus
+		profile.ProfilePicture = newProfile.ProfilePicture
+		profile.ProfilePictureBlurhash = newProfile.ProfilePictureBlurhash
+		profile.ProfilePictureColor = newProfile.ProfilePictureColor
+		profile.ProfilePictureStatus = app.newPictureStatus()
+	}
+
+	// Update the Profile, and move the old picture to the history
+	err = app.updateProfilePicture(profile, oldPicture, oldStatus)
+	if err != nil {
+		// Keep the old picture, and remove the new one
+		// because the Profile has not been changed
+		app.cleanupProfilePicture(r, newProfile.ProfilePicture)
+
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
 			app.serverErrorResponse(w, r, err)
-			return
 		}
+		return
+	}
 
-		// Create an uploading folder if it doesn't
-		// already exist
-		err = os.MkdirAll(app.Config.Uploads, os.ModePerm)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
+	// Prune the history only after the Profile has been updated,
+	// the request has succeeded even if the old files can't be removed
+	app.retireProfilePicture(r, profile, oldPicture)
+	app.indexProfile(profile)
+
+	// Check the new picture with the content scanner
+	app.startPictureScan(profile)
+
+	// Send back the Profile to the request response
+	app.setProfilePictureURLs(profile)
+	err = app.writeJSON(w, http.StatusOK, envelope{"profile": profile}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readProfileDetails sets the details of the Profile which are in the form,
+// an empty value clears a detail. The social links are a JSON array,
+// and the attributes are a JSON object which replaces the old one.
+func (app *Application) readProfileDetails(r *http.Request, profile *data.Profile, v *validator.Validator) {
+	if value, ok := r.PostForm["profile_headline_t"]; ok {
+		profile.ProfileHeadline = strings.TrimSpace(value[0])
+	}
+
+	if value, ok := r.PostForm["profile_bio_t"]; ok {
+		profile.ProfileBio = strings.TrimSpace(value[0])
+	}
+
+	if value, ok := r.PostForm["profile_location_t"]; ok {
+		profile.ProfileLocation = strings.TrimSpace(value[0])
+	}
+
+	if value, ok := r.PostForm["profile_website_s"]; ok {
+		profile.ProfileWebsite = strings.TrimSpace(value[0])
+	}
+
+	if value, ok := r.PostForm["profile_social_links"]; ok {
+		links := data.SocialLinks{}
+		if strings.TrimSpace(value[0]) != "" {
+			err := json.Unmarshal([]byte(value[0]), &links)
+			if err != nil {
+				v.AddError("profile_social_links", "must be a JSON array of links with a type and a URL")
+				return
+			}
 		}
+		profile.ProfileSocialLinks = links
+	}
 
-		// Delete the old profile picture
-		if _, err := os.Stat(fmt.Sprintf("%s/%s", app.Config.Uploads, profile.ProfilePicture)); err == nil {
-			err = os.Remove(fmt.Sprintf("%s/%s", app.Config.Uploads, profile.ProfilePicture))
+	if value, ok := r.PostForm["attributes"]; ok {
+		attributes := data.Attributes{}
+		if strings.TrimSpace(value[0]) != "" {
+			err := json.Unmarshal([]byte(value[0]), &attributes)
 			if err != nil {
-				app.serverErrorResponse(w, r, err)
+				v.AddError("attributes", "must be a JSON object")
 				return
 			}
 		}
+		profile.Attributes = attributes
+	}
+}
 
-		// Create a new file in the uploads directory
-		dst, err := os.Create(fmt.Sprintf("%s/%s", app.Config.Uploads, profilePicture))
-		if err != nil {
+// deleteProfileHandler function to delete a Profile with its pictures
+func (app *Application) deleteProfileHandler(w http.ResponseWriter, r *http.Request) {
+	// Only the owner of the Profile can delete it
+	profile, ok := app.readOwnProfile(w, r)
+	if !ok {
+		return
+	}
+
+	app.deleteProfile(w, r, profile)
+}
+
+// deleteMyProfileHandler function to delete the Profile of the current user
+func (app *Application) deleteMyProfileHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the current user as the owner of the Profile
+	user := app.contextGetUser(r)
+
+	profile, err := app.Models.Profiles.GetByProfileUser(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
 			app.serverErrorResponse(w, r, err)
-			return
 		}
-		defer dst.Close()
+		return
+	}
 
-		// Copy the uploaded file to the filesystem
-		// at the specified destination
-		_, err = io.Copy(dst, file)
-		if err != nil {
+	app.deleteProfile(w, r, profile)
+}
+
+// deleteProfile removes the Profile from the database, and then
+// the current and the previous pictures with the variants
+func (app *Application) deleteProfile(w http.ResponseWriter, r *http.Request, profile *data.Profile) {
+	// The picture history is removed together with the Profile,
+	// so the names of its files have to be read first
+	history, err := app.Models.PictureHistory.GetAllByProfile(profile.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Profiles.Delete(profile.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
 			app.serverErrorResponse(w, r, err)
-			return
 		}
+		return
 	}
+	app.unindexProfile(profile.ID)
 
-	// Update the old profile picture with a new one
-	if newProfile.ProfileName != "" {
-		profile.ProfileName = newProfile.ProfileName
+	// The request has succeeded even if a file can't be removed,
+	// the garbage collector deletes it later
+	app.cleanupProfilePicture(r, profile.ProfilePicture)
+	for _, entry := range history {
+		app.cleanupProfilePicture(r, entry.ProfilePicture)
 	}
 
-	if newProfile.ProfilePicture != "" {
-		profile.ProfilePicture = newProfile.ProfilePicture
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteProfilePictureHandler function to remove the picture of a Profile
+func (app *Application) deleteProfilePictureHandler(w http.ResponseWriter, r *http.Request) {
+	// Only the owner of the Profile can remove the picture
+	profile, ok := app.readOwnProfile(w, r)
+	if !ok {
+		return
 	}
 
-	// Update the Profile
-	err = app.Models.Profiles.Update(profile)
+	// Clear the picture, the version of the Profile
+	// protects it against a concurrent update
+	oldPicture := profile.ProfilePicture
+	profile.ProfilePicture = ""
+	profile.ProfilePictureStatus = ""
+	profile.ProfilePictureBlurhash = ""
+	profile.ProfilePictureColor = ""
+
+	err := app.Models.Profiles.Update(profile)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -267,7 +559,12 @@ func (app *Application) patchProfileHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Delete the picture with the variants after the Profile has been updated
+	app.cleanupProfilePicture(r, oldPicture)
+	app.indexProfile(profile)
+
 	// Send back the Profile to the request response
+	app.setProfilePictureURLs(profile)
 	err = app.writeJSON(w, http.StatusOK, envelope{"profile": profile}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -283,16 +580,145 @@ func (app *Application) getProfilePictureHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// Read file
-	buffer, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", app.Config.Uploads, file))
+	// Select a square variant of the picture
+	qs := r.URL.Query()
+	v := validator.New()
+	size := app.readInt(qs, "size", 0, v)
+	v.Check(size == 0 || app.isPictureVariant(size), "size", "must be one of the picture variants")
+
+	// Or resize the picture on demand, a missing
+	// width or height is the same as the other one
+	width := app.readInt(qs, "w", 0, v)
+	height := app.readInt(qs, "h", 0, v)
+	fit := app.readString(qs, "fit", picture.FitCover)
+	resize := width != 0 || height != 0
+	if resize {
+		if width == 0 {
+			width = height
+		}
+		if height == 0 {
+			height = width
+		}
+
+		v.Check(app.isResizeSize(width), "w", "must be one of the resize sizes")
+		v.Check(app.isResizeSize(height), "h", "must be one of the resize sizes")
+		v.Check(picture.IsFit(fit), "fit", "must be cover or contain")
+		v.Check(size == 0, "size", "must not be sent with w or h")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// A generated avatar changes with the Profile name,
+	// so it can't be cached like an uploaded picture
+	cacheControl := app.Config.Pictures.CacheControl
+	avatarProfile, avatarFormat, isAvatar := parseAvatarName(file)
+	if isAvatar {
+		cacheControl = app.Config.Pictures.AvatarCacheControl
+	}
+
+	// Check the signature of the URL, the picture is private when the signing
+	// is enabled. The signature covers the resize, so a signed URL can't be
+	// changed to resize the picture to another size.
+	if app.Config.Pictures.Signing.Enabled {
+		params := pictureParams(size, 0, 0, "")
+		if resize {
+			params = pictureParams(size, width, height, fit)
+		}
+
+		left, ok := app.verifyPictureSignature(qs, file, params)
+		if !ok {
+			app.invalidSignatureResponse(w, r)
+			return
+		}
+
+		// Don't let a shared cache keep the picture
+		// longer than the URL is valid
+		cacheControl = fmt.Sprintf("private, max-age=%d", int(left.Seconds()))
+	}
+
+	if isAvatar {
+		// A generated avatar is always a square
+		if resize {
+			v.Check(width == height, "h", "must be equal to w for a generated avatar")
+			if !v.Valid() {
+				app.failedValidationResponse(w, r, v.Errors)
+				return
+			}
+			size = width
+		}
+
+		app.serveProfileAvatar(w, r, avatarProfile, avatarFormat, size, cacheControl)
+		return
+	}
+
+	// Serve only a picture which has been approved by the content scanner,
+	// without a scanner every picture is approved on upload
+	if app.Scanner != nil {
+		status, err := app.Models.Profiles.GetPictureStatus(file)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if status != data.PictureStatusApproved {
+			app.servePicturePlaceholder(w, r, status, size)
+			return
+		}
+	}
+
+	if resize {
+		app.serveResizedPicture(w, r, file, width, height, fit, cacheControl)
+		return
+	}
+
+	if size != 0 {
+		file = picture.VariantName(file, size)
+	}
+
+	// Open file from the storage
+	content, info, err := app.Storage.Get(file)
 	if err != nil {
-		app.notFoundResponse(w, r)
+		switch {
+		case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrInvalidName):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
+	defer content.Close()
 
 	// Check type of file
-	filetype := http.DetectContentType(buffer)
+	buff := make([]byte, 512)
+	n, err := io.ReadFull(content, buff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	filetype := http.DetectContentType(buff[:n])
+
+	// Read file from the beginning offset
+	_, err = content.Seek(0, io.SeekStart)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	w.Header().Set("Content-Type", filetype)
-	w.Write(buffer)
+	w.Header().Set("Cache-Control", cacheControl)
+	if info.ETag != "" {
+		w.Header().Set("ETag", fmt.Sprintf("%q", info.ETag))
+	}
+
+	// Stream the file, the conditional requests
+	// and the byte ranges are handled by ServeContent
+	http.ServeContent(w, r, file, info.ModTime, content)
 }
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/e-inwork-com/go-profile-service/internal/picture"
+	"github.com/e-inwork-com/go-profile-service/internal/storage"
+)
+
+// isResizeSize checks if the width or the height
+// is one of the allowed sizes of a resized picture
+func (app *Application) isResizeSize(size int) bool {
+	for _, allowed := range app.Config.Pictures.ResizeSizes {
+		if size == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serveResizedPicture serves a picture resized on demand. The result is
+// kept in the disk cache, and it never changes because the name of
+// the picture is derived from its content. The cache outlives a deleted
+// picture, so the stored picture is checked before every hit.
+func (app *Application) serveResizedPicture(w http.ResponseWriter, r *http.Request, file string, width int, height int, fit string, cacheControl string) {
+	_, err := app.Storage.Stat(file)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrInvalidName):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ext := filepath.Ext(file)
+	key := fmt.Sprintf("%s_%dx%d_%s%s", strings.TrimSuffix(file, ext), width, height, fit, ext)
+
+	resize := func() ([]byte, error) {
+		return app.resizePicture(file, width, height, fit)
+	}
+
+	var buff []byte
+	if app.PictureCache != nil {
+		buff, err = app.PictureCache.GetOrCreate(key, resize)
+	} else {
+		buff, err = resize()
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrInvalidName):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(buff))
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", fmt.Sprintf("%q", key))
+
+	http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(buff))
+}
+
+// resizePicture reads a stored picture, and encodes it
+// in the same format with the new size
+func (app *Application) resizePicture(file string, width int, height int, fit string) ([]byte, error) {
+	content, _, err := app.Storage.Get(file)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+
+	img, format, err := picture.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The stored pictures are in the configured format,
+	// except the pictures which have never been migrated
+	if !picture.IsFormat(format) {
+		format = app.Config.Pictures.Format
+	}
+
+	var buff bytes.Buffer
+	err = picture.Encode(&buff, picture.Resize(img, width, height, fit), format)
+	if err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
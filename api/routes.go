@@ -10,16 +10,43 @@ import (
 func (app *Application) Routes() http.Handler {
 	router := httprouter.New()
 
-	router.NotFound = http.HandlerFunc(app.notFoundResponse)
+	router.NotFound = app.profileRoutes()
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	router.HandlerFunc(http.MethodGet, "/service/profiles/health", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/service/profiles", app.listProfilesHandler)
+	router.HandlerFunc(http.MethodGet, "/service/profiles/search", app.searchProfilesHandler)
 	router.HandlerFunc(http.MethodPost, "/service/profiles", app.requireAuthenticated(app.createProfileHandler))
 	router.HandlerFunc(http.MethodGet, "/service/profiles/me", app.requireAuthenticated(app.getProfileHandler))
-	router.HandlerFunc(http.MethodPatch, "/service/profiles/:id", app.requireAuthenticated(app.patchProfileHandler))
+	router.HandlerFunc(http.MethodDelete, "/service/profiles/me", app.requireAuthenticated(app.deleteMyProfileHandler))
 	router.HandlerFunc(http.MethodGet, "/service/profiles/pictures/:file", app.getProfilePictureHandler)
+	router.HandlerFunc(http.MethodPost, "/service/profiles/uploads", app.requireAuthenticated(app.createUploadHandler))
+	router.HandlerFunc(http.MethodGet, "/service/profiles/uploads/:id", app.requireAuthenticated(app.getUploadHandler))
+	router.HandlerFunc(http.MethodPatch, "/service/profiles/uploads/:id", app.requireAuthenticated(app.patchUploadHandler))
+	router.HandlerFunc(http.MethodDelete, "/service/profiles/uploads/:id", app.requireAuthenticated(app.deleteUploadHandler))
+	router.HandlerFunc(http.MethodPost, "/service/profiles/uploads/:id/finalize", app.requireAuthenticated(app.finalizeUploadHandler))
 
 	router.Handler(http.MethodGet, "/service/profiles/debug/vars", expvar.Handler())
 
 	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
 }
+
+// profileRoutes returns the routes of a single Profile. httprouter doesn't
+// allow a wildcard next to a static segment such as "uploads" in the same
+// path, so these routes are on a second router which handles the requests
+// that don't match any route of the first one.
+func (app *Application) profileRoutes() http.Handler {
+	router := httprouter.New()
+
+	router.NotFound = http.HandlerFunc(app.notFoundResponse)
+	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+
+	router.HandlerFunc(http.MethodGet, "/service/profiles/:id", app.getProfileByIDHandler)
+	router.HandlerFunc(http.MethodPatch, "/service/profiles/:id", app.requireAuthenticated(app.patchProfileHandler))
+	router.HandlerFunc(http.MethodDelete, "/service/profiles/:id", app.requireAuthenticated(app.deleteProfileHandler))
+	router.HandlerFunc(http.MethodDelete, "/service/profiles/:id/picture", app.requireAuthenticated(app.deleteProfilePictureHandler))
+	router.HandlerFunc(http.MethodGet, "/service/profiles/:id/picture/history", app.requireAuthenticated(app.listPictureHistoryHandler))
+	router.HandlerFunc(http.MethodPost, "/service/profiles/:id/picture/history/:history/restore", app.requireAuthenticated(app.restorePictureHistoryHandler))
+
+	return router
+}
@@ -1,11 +1,31 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/e-inwork-com/go-profile-service/internal/data"
 	"github.com/e-inwork-com/go-profile-service/internal/data/mocks"
+	"github.com/e-inwork-com/go-profile-service/internal/picture"
+	"github.com/e-inwork-com/go-profile-service/internal/scanner"
+	"github.com/e-inwork-com/go-profile-service/internal/storage"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,6 +38,7 @@ func TestRoutes(t *testing.T) {
 	firstToken := app.testFirstToken(t)
 	secondToken := app.testSecondToken(t)
 	tBody, tContentType := app.testFormProfile(t)
+	tPatchBody, tPatchContentType := app.testFormProfile(t)
 
 	tests := []struct {
 		name         string
@@ -55,13 +76,58 @@ func TestRoutes(t *testing.T) {
 			body:         nil,
 			expectedCode: http.StatusOK,
 		},
+		{
+			name:         "Get Profile Picture Variant",
+			method:       "GET",
+			urlPath:      "/service/profiles/pictures/" + mocks.MockFirstUUID().String() + ".jpg?size=64",
+			contentType:  "",
+			token:        "",
+			body:         nil,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Get Profile Picture Invalid Size",
+			method:       "GET",
+			urlPath:      "/service/profiles/pictures/" + mocks.MockFirstUUID().String() + ".jpg?size=65",
+			contentType:  "",
+			token:        "",
+			body:         nil,
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Get Profile Avatar",
+			method:       "GET",
+			urlPath:      "/service/profiles/pictures/avatar-" + mocks.MockFirstUUID().String() + ".png?size=64",
+			contentType:  "",
+			token:        "",
+			body:         nil,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Get Profile Avatar SVG",
+			method:       "GET",
+			urlPath:      "/service/profiles/pictures/avatar-" + mocks.MockFirstUUID().String() + ".svg",
+			contentType:  "",
+			token:        "",
+			body:         nil,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Get Profile Avatar Not Found",
+			method:       "GET",
+			urlPath:      "/service/profiles/pictures/avatar-" + mocks.MockSecondUUID().String() + ".png",
+			contentType:  "",
+			token:        "",
+			body:         nil,
+			expectedCode: http.StatusNotFound,
+		},
 		{
 			name:         "Patch Profile",
 			method:       "PATCH",
 			urlPath:      "/service/profiles/" + mocks.MockFirstUUID().String(),
-			contentType:  tContentType,
+			contentType:  tPatchContentType,
 			token:        firstToken,
-			body:         tBody,
+			body:         tPatchBody,
 			expectedCode: http.StatusOK,
 		},
 		{
@@ -82,4 +148,1640 @@ func TestRoutes(t *testing.T) {
 		})
 	}
 
+	t.Run("Picture Delete", func(t *testing.T) {
+		testPictureDelete(t, app, ts)
+	})
+
+	t.Run("Picture Limits", func(t *testing.T) {
+		testPictureLimits(t, app, ts)
+	})
+
+	t.Run("Picture Crop", func(t *testing.T) {
+		testPictureCrop(t, app, ts)
+	})
+
+	t.Run("Picture Formats", func(t *testing.T) {
+		testPictureFormats(t, app, ts)
+	})
+
+	t.Run("Picture Replacement", func(t *testing.T) {
+		testPictureReplacement(t, app, ts)
+	})
+
+	t.Run("Picture Caching", func(t *testing.T) {
+		testPictureCaching(t, app, ts)
+	})
+
+	t.Run("Picture Signing", func(t *testing.T) {
+		testPictureSigning(t, app, ts)
+	})
+
+	t.Run("Resumable Upload", func(t *testing.T) {
+		testResumableUpload(t, app, ts)
+	})
+
+	t.Run("Picture Scanning", func(t *testing.T) {
+		testPictureScanning(t, app, ts)
+	})
+
+	t.Run("Picture History", func(t *testing.T) {
+		testPictureHistory(t, app, ts)
+	})
+
+	t.Run("Picture Resize", func(t *testing.T) {
+		testPictureResize(t, app, ts)
+	})
+
+	t.Run("Picture Metadata", func(t *testing.T) {
+		testPictureMetadata(t, app, ts)
+	})
+
+	t.Run("Profile Delete", func(t *testing.T) {
+		testProfileDelete(t, app, ts)
+	})
+
+	t.Run("Profile Visibility", func(t *testing.T) {
+		testProfileVisibility(t, app, ts)
+	})
+
+	t.Run("Profile List", func(t *testing.T) {
+		testProfileList(t, app, ts)
+	})
+
+	t.Run("Profile Search", func(t *testing.T) {
+		testProfileSearch(t, app, ts)
+	})
+
+	t.Run("Profile Indexing", func(t *testing.T) {
+		testProfileIndexing(t, app, ts)
+	})
+
+	t.Run("Profile Details", func(t *testing.T) {
+		testProfileDetails(t, app, ts)
+	})
+
+	t.Run("Profile Attributes", func(t *testing.T) {
+		testProfileAttributes(t, app, ts)
+	})
+
+	t.Run("Upload Limit", func(t *testing.T) {
+		testUploadLimit(t, app, ts)
+	})
+
+	t.Run("Upload CORS", func(t *testing.T) {
+		testUploadCORS(t, app, ts)
+	})
+}
+
+func testPictureCaching(t *testing.T, app *Application, ts *httpTestServer) {
+	// The picture of the mock Profile is replaced by the Patch tests
+	app.testCopyUploads(t)
+
+	urlPath := "/service/profiles/pictures/" + mocks.MockFirstUUID().String() + ".jpg"
+
+	code, header, body := ts.requestHeaders(t, "GET", urlPath, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, app.Config.Pictures.CacheControl, header.Get("Cache-Control"))
+	assert.NotEmpty(t, header.Get("ETag"))
+	assert.NotEmpty(t, header.Get("Last-Modified"))
+
+	t.Run("If-None-Match", func(t *testing.T) {
+		code, _, _ := ts.requestHeaders(t, "GET", urlPath, http.Header{
+			"If-None-Match": {header.Get("ETag")},
+		})
+		assert.Equal(t, http.StatusNotModified, code)
+	})
+
+	t.Run("If-Modified-Since", func(t *testing.T) {
+		code, _, _ := ts.requestHeaders(t, "GET", urlPath, http.Header{
+			"If-Modified-Since": {header.Get("Last-Modified")},
+		})
+		assert.Equal(t, http.StatusNotModified, code)
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		code, _, rangeBody := ts.requestHeaders(t, "GET", urlPath, http.Header{
+			"Range": {"bytes=0-99"},
+		})
+		assert.Equal(t, http.StatusPartialContent, code)
+		assert.Equal(t, body[:100], rangeBody)
+	})
+}
+
+func testPictureSigning(t *testing.T, app *Application, ts *httpTestServer) {
+	app.testCopyUploads(t)
+
+	app.Config.Pictures.Signing.Enabled = true
+	app.Config.Pictures.Signing.Secret = "picture-secret"
+	app.Config.Pictures.Signing.TTL = time.Hour
+	defer func() {
+		app.Config.Pictures.Signing.Enabled = false
+	}()
+
+	file := mocks.MockFirstUUID().String() + ".jpg"
+	expired := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		expectedCode int
+	}{
+		{
+			name:         "Signed",
+			urlPath:      app.pictureURL(file, 0),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Signed Variant",
+			urlPath:      app.pictureURL(file, 64),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Missing Signature",
+			urlPath:      "/service/profiles/pictures/" + file,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Tampered Size",
+			urlPath:      strings.Replace(app.pictureURL(file, 64), "size=64", "size=128", 1),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Signed Resize",
+			urlPath:      app.resizedPictureURL(file, 64, 64, "cover"),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Tampered Width",
+			urlPath:      strings.Replace(app.resizedPictureURL(file, 64, 64, "cover"), "w=64", "w=96", 1),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Tampered Fit",
+			urlPath:      strings.Replace(app.resizedPictureURL(file, 64, 64, "cover"), "fit=cover", "fit=contain", 1),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Added Resize",
+			urlPath:      app.pictureURL(file, 0) + "&w=64",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Expired",
+			urlPath:      fmt.Sprintf("/service/profiles/pictures/%s?expires=%d&signature=%s", file, expired, app.signPicture(file, url.Values{}, expired)),
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actualCode, header, _ := ts.requestHeaders(t, "GET", tt.urlPath, nil)
+			assert.Equal(t, tt.expectedCode, actualCode)
+
+			if actualCode == http.StatusOK {
+				assert.True(t, strings.HasPrefix(header.Get("Cache-Control"), "private"))
+			}
+		})
+	}
+}
+
+func testPictureLimits(t *testing.T, app *Application, ts *httpTestServer) {
+	limits := app.Config.Pictures
+	defer func() {
+		app.Config.Pictures = limits
+	}()
+
+	firstToken := app.testFirstToken(t)
+	urlPath := "/service/profiles/" + mocks.MockFirstUUID().String()
+
+	t.Run("Too Many Bytes", func(t *testing.T) {
+		app.Config.Pictures = limits
+		app.Config.Pictures.MaxBytes = 1024
+
+		tBody, tContentType := app.testFormProfile(t)
+		code, _, _ := ts.request(t, "PATCH", urlPath, tContentType, firstToken, tBody)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	})
+
+	t.Run("Too Wide", func(t *testing.T) {
+		app.Config.Pictures = limits
+		app.Config.Pictures.MaxWidth = 16
+
+		tBody, tContentType := app.testFormProfile(t)
+		code, _, body := ts.request(t, "PATCH", urlPath, tContentType, firstToken, tBody)
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+		assert.Contains(t, body, "profile_picture_s")
+	})
+
+	t.Run("Too Many Pixels", func(t *testing.T) {
+		app.Config.Pictures = limits
+		app.Config.Pictures.MaxPixels = 256
+
+		tBody, tContentType := app.testFormProfile(t)
+		code, _, body := ts.request(t, "PATCH", urlPath, tContentType, firstToken, tBody)
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+		assert.Contains(t, body, "profile_picture_s")
+	})
+}
+
+func testPictureFormats(t *testing.T, app *Application, ts *httpTestServer) {
+	firstToken := app.testFirstToken(t)
+	urlPath := "/service/profiles/" + mocks.MockFirstUUID().String()
+
+	// Animated GIF with a red and a blue frame
+	palette := color.Palette{color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}}
+	animation := &gif.GIF{}
+	for i := range palette {
+		frame := image.NewPaletted(image.Rect(0, 0, 16, 16), palette)
+		for p := range frame.Pix {
+			frame.Pix[p] = uint8(i)
+		}
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	var animated bytes.Buffer
+	err := gif.EncodeAll(&animated, animation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webp, err := os.ReadFile("./test/images/profile.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	webpConfig, _, err := picture.DecodeConfig(webp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// upload sends the picture, and returns the stored picture
+	upload := func(t *testing.T, filename string, content []byte) image.Image {
+		tBody, tContentType := app.testForm(t, nil, filename, content)
+		code, _, body := ts.request(t, "PATCH", urlPath, tContentType, firstToken, tBody)
+		if !assert.Equal(t, http.StatusOK, code, body) {
+			return nil
+		}
+
+		var response map[string]data.Profile
+		err := json.Unmarshal([]byte(body), &response)
+		assert.Nil(t, err)
+
+		// The picture is stored in the configured format
+		name := response["profile"].ProfilePicture
+		assert.True(t, strings.HasSuffix(name, ".jpg"))
+
+		file, _, err := app.Storage.Get(name)
+		if !assert.Nil(t, err) {
+			return nil
+		}
+		defer file.Close()
+
+		img, format, err := image.Decode(file)
+		if !assert.Nil(t, err) {
+			return nil
+		}
+		assert.Equal(t, "jpeg", format)
+
+		return img
+	}
+
+	t.Run("GIF", func(t *testing.T) {
+		img := upload(t, "profile.gif", animated.Bytes())
+		if img == nil {
+			return
+		}
+
+		// The stored picture is the first frame
+		r, _, b, _ := img.At(8, 8).RGBA()
+		assert.Greater(t, r, b)
+	})
+
+	t.Run("WebP", func(t *testing.T) {
+		img := upload(t, "profile.webp", webp)
+		if img == nil {
+			return
+		}
+
+		assert.Equal(t, webpConfig.Width, img.Bounds().Dx())
+		assert.Equal(t, webpConfig.Height, img.Bounds().Dy())
+	})
+
+	t.Run("Not An Image", func(t *testing.T) {
+		tBody, tContentType := app.testForm(t, nil, "profile.jpg", []byte("not an image"))
+		code, _, body := ts.request(t, "PATCH", urlPath, tContentType, firstToken, tBody)
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+		assert.Contains(t, body, "profile_picture_s")
+	})
+}
+
+func testPictureReplacement(t *testing.T, app *Application, ts *httpTestServer) {
+	app.testCopyUploads(t)
+
+	// Without a history the old picture is deleted at once
+	history := app.Config.Pictures.History
+	app.Config.Pictures.History = 0
+	defer func() {
+		app.Config.Pictures.History = history
+	}()
+
+	oldPicture := mocks.MockFirstUUID().String() + ".jpg"
+
+	tBody, tContentType := app.testFormProfile(t)
+	code, _, body := ts.request(t, "PATCH", "/service/profiles/"+mocks.MockFirstUUID().String(), tContentType, app.testFirstToken(t), tBody)
+	assert.Equal(t, http.StatusOK, code)
+
+	var response map[string]data.Profile
+	err := json.Unmarshal([]byte(body), &response)
+	assert.Nil(t, err)
+
+	// The new picture and its variants are stored
+	newPicture := response["profile"].ProfilePicture
+	_, err = app.Storage.Stat(newPicture)
+	assert.Nil(t, err)
+	for _, variant := range app.Config.Pictures.Variants {
+		_, err = app.Storage.Stat(picture.VariantName(newPicture, variant))
+		assert.Nil(t, err)
+	}
+
+	// The old picture and its variants are removed after the update
+	_, err = app.Storage.Stat(oldPicture)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	for _, variant := range app.Config.Pictures.Variants {
+		_, err = app.Storage.Stat(picture.VariantName(oldPicture, variant))
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	}
+
+	// A failed write keeps the old picture, and removes the new files
+	profiles := app.Models.Profiles.(*mocks.ProfileModel)
+	failures := []struct {
+		name         string
+		method       string
+		urlPath      string
+		insertErr    error
+		updateErr    error
+		expectedCode int
+	}{
+		{
+			name:         "Edit Conflict",
+			method:       "PATCH",
+			urlPath:      "/service/profiles/" + mocks.MockFirstUUID().String(),
+			updateErr:    data.ErrEditConflict,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "Update Error",
+			method:       "PATCH",
+			urlPath:      "/service/profiles/" + mocks.MockFirstUUID().String(),
+			updateErr:    errors.New("database is down"),
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "Duplicate User",
+			method:       "POST",
+			urlPath:      "/service/profiles",
+			insertErr:    data.ErrDuplicateUser,
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Insert Error",
+			method:       "POST",
+			urlPath:      "/service/profiles",
+			insertErr:    errors.New("database is down"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			app.testCopyUploads(t)
+			before := app.testListUploads(t)
+
+			profiles.InsertErr, profiles.UpdateErr = tt.insertErr, tt.updateErr
+			defer func() {
+				profiles.InsertErr, profiles.UpdateErr = nil, nil
+			}()
+
+			tBody, tContentType := app.testFormProfile(t)
+			code, _, _ := ts.request(t, tt.method, tt.urlPath, tContentType, app.testFirstToken(t), tBody)
+			assert.Equal(t, tt.expectedCode, code)
+
+			assert.Equal(t, before, app.testListUploads(t))
+			_, err := app.Storage.Stat(oldPicture)
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func testPictureDelete(t *testing.T, app *Application, ts *httpTestServer) {
+	app.testCopyUploads(t)
+
+	urlPath := "/service/profiles/" + mocks.MockFirstUUID().String() + "/picture"
+	oldPicture := mocks.MockFirstUUID().String() + ".jpg"
+
+	t.Run("Forbidden", func(t *testing.T) {
+		code, _, _ := ts.request(t, "DELETE", urlPath, "", app.testSecondToken(t), nil)
+		assert.Equal(t, http.StatusForbidden, code)
+
+		_, err := app.Storage.Stat(oldPicture)
+		assert.Nil(t, err)
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, _, _ := ts.request(t, "DELETE", urlPath, "", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		code, _, body := ts.request(t, "DELETE", urlPath, "", app.testFirstToken(t), nil)
+		assert.Equal(t, http.StatusOK, code)
+
+		var response map[string]data.Profile
+		err := json.Unmarshal([]byte(body), &response)
+		assert.Nil(t, err)
+		assert.Empty(t, response["profile"].ProfilePicture)
+
+		// The removed picture is deleted even with a picture history
+		_, err = app.Storage.Stat(oldPicture)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		for _, variant := range app.Config.Pictures.Variants {
+			_, err = app.Storage.Stat(picture.VariantName(oldPicture, variant))
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		}
+	})
+}
+
+func testPictureCrop(t *testing.T, app *Application, ts *httpTestServer) {
+	firstToken := app.testFirstToken(t)
+	urlPath := "/service/profiles/" + mocks.MockFirstUUID().String()
+
+	content, err := os.ReadFile("./test/images/profile.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		fields       map[string]string
+		filename     string
+		expectedCode int
+		expectedKey  string
+	}{
+		{
+			name:         "Crop",
+			fields:       map[string]string{"crop_x": "10", "crop_y": "5", "crop_width": "30", "crop_height": "20"},
+			filename:     "profile.jpg",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Outside Of The Image",
+			fields:       map[string]string{"crop_x": "30", "crop_y": "0", "crop_width": "30", "crop_height": "20"},
+			filename:     "profile.jpg",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedKey:  "crop_width",
+		},
+		{
+			name:         "Overflow",
+			fields:       map[string]string{"crop_x": "9223372036854775807", "crop_y": "0", "crop_width": "9223372036854775807", "crop_height": "20"},
+			filename:     "profile.jpg",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedKey:  "crop_width",
+		},
+		{
+			name:         "Incomplete",
+			fields:       map[string]string{"crop_x": "0", "crop_y": "0"},
+			filename:     "profile.jpg",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedKey:  "crop_width",
+		},
+		{
+			name:         "Not An Integer",
+			fields:       map[string]string{"crop_x": "a", "crop_y": "0", "crop_width": "10", "crop_height": "10"},
+			filename:     "profile.jpg",
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedKey:  "crop_x",
+		},
+		{
+			name:         "Without A Picture",
+			fields:       map[string]string{"crop_x": "0", "crop_y": "0", "crop_width": "10", "crop_height": "10"},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedKey:  "crop_x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tBody, tContentType := app.testForm(t, tt.fields, tt.filename, content)
+			code, _, body := ts.request(t, "PATCH", urlPath, tContentType, firstToken, tBody)
+			assert.Equal(t, tt.expectedCode, code)
+
+			if tt.expectedKey != "" {
+				assert.Contains(t, body, tt.expectedKey)
+				return
+			}
+
+			// The stored picture has the size of the crop rectangle
+			var response map[string]data.Profile
+			err := json.Unmarshal([]byte(body), &response)
+			assert.Nil(t, err)
+
+			file, _, err := app.Storage.Get(response["profile"].ProfilePicture)
+			if !assert.Nil(t, err) {
+				return
+			}
+			defer file.Close()
+
+			config, _, err := image.DecodeConfig(file)
+			assert.Nil(t, err)
+			assert.Equal(t, 30, config.Width)
+			assert.Equal(t, 20, config.Height)
+		})
+	}
+}
+
+func testResumableUpload(t *testing.T, app *Application, ts *httpTestServer) {
+	app.testCopyUploads(t)
+
+	content, err := os.ReadFile("./test/images/profile.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstToken := app.testFirstToken(t)
+	otherToken := app.testCreateToken(t, mocks.MockSecondUUID())
+
+	// Start the upload
+	tBody := strings.NewReader(fmt.Sprintf(`{"size": %d}`, len(content)))
+	code, header, body := ts.request(t, "POST", "/service/profiles/uploads", "application/json", firstToken, tBody)
+	if !assert.Equal(t, http.StatusCreated, code, body) {
+		return
+	}
+
+	urlPath := header.Get("Location")
+	assert.True(t, strings.HasPrefix(urlPath, "/service/profiles/uploads/"))
+
+	// Send a chunk to the upload
+	sendChunk := func(token string, offset int, chunk []byte) (int, http.Header) {
+		rq, _ := http.NewRequest("PATCH", ts.URL+urlPath, bytes.NewReader(chunk))
+		rq.Header.Set("Content-Type", "application/offset+octet-stream")
+		rq.Header.Set("Upload-Offset", strconv.Itoa(offset))
+		rq.Header.Set("Authorization", "Bearer "+token)
+
+		rs, err := ts.Client().Do(rq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+
+		return rs.StatusCode, rs.Header
+	}
+
+	half := len(content) / 2
+
+	code, header = sendChunk(firstToken, 0, content[:half])
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, strconv.Itoa(half), header.Get("Upload-Offset"))
+
+	// The upload belongs to the user who started it
+	code, _ = sendChunk(otherToken, half, content[half:])
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// A chunk with a wrong offset is rejected with the current offset
+	code, header = sendChunk(firstToken, 0, content[:half])
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, strconv.Itoa(half), header.Get("Upload-Offset"))
+
+	// The upload can't be attached before it is complete
+	code, _, body = ts.request(t, "POST", urlPath+"/finalize", "", firstToken, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Contains(t, body, "offset")
+
+	// Resume the upload from the offset of the server
+	code, header, _ = ts.request(t, "GET", urlPath, "", firstToken, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, strconv.Itoa(half), header.Get("Upload-Offset"))
+
+	code, header = sendChunk(firstToken, half, content[half:])
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, strconv.Itoa(len(content)), header.Get("Upload-Offset"))
+
+	// Attach the picture to the Profile
+	code, _, body = ts.request(t, "POST", urlPath+"/finalize", "", firstToken, nil)
+	if !assert.Equal(t, http.StatusOK, code, body) {
+		return
+	}
+
+	var response map[string]data.Profile
+	err = json.Unmarshal([]byte(body), &response)
+	assert.Nil(t, err)
+	assert.True(t, picture.IsContentName(response["profile"].ProfilePicture))
+
+	// The upload is removed after it has been attached
+	code, _, _ = ts.request(t, "GET", urlPath, "", firstToken, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func testUploadLimit(t *testing.T, app *Application, ts *httpTestServer) {
+	app.Staging.MaxSessions = 1
+	defer func() {
+		app.Staging.MaxSessions = 0
+	}()
+
+	token := app.testSecondToken(t)
+
+	code, _, body := ts.request(t, "POST", "/service/profiles/uploads", "application/json", token, strings.NewReader(`{"size": 10}`))
+	assert.Equal(t, http.StatusCreated, code, body)
+
+	code, _, _ = ts.request(t, "POST", "/service/profiles/uploads", "application/json", token, strings.NewReader(`{"size": 10}`))
+	assert.Equal(t, http.StatusTooManyRequests, code)
+}
+
+func testPictureScanning(t *testing.T, app *Application, ts *httpTestServer) {
+	app.testCopyUploads(t)
+
+	// The fake scanner waits for the verdict of the test
+	verdicts := make(chan bool)
+	app.Scanner = scanner.Func(func(ctx context.Context, r io.Reader) (*scanner.Result, error) {
+		_, err := io.Copy(io.Discard, r)
+		if err != nil {
+			return nil, err
+		}
+
+		return &scanner.Result{Infected: <-verdicts, Signature: "Test-Signature"}, nil
+	})
+	defer func() {
+		app.Scanner = nil
+	}()
+
+	tests := []struct {
+		name           string
+		infected       bool
+		expectedStatus string
+	}{
+		{
+			name:           "Approved",
+			expectedStatus: data.PictureStatusApproved,
+		},
+		{
+			name:           "Rejected",
+			infected:       true,
+			expectedStatus: data.PictureStatusRejected,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Upload a picture with another content each time
+			img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+			img.Set(0, 0, color.RGBA{R: uint8(i), A: 0xff})
+
+			var content bytes.Buffer
+			err := picture.Encode(&content, img, "png")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tBody, tContentType := app.testForm(t, nil, "profile.png", content.Bytes())
+			code, _, body := ts.request(t, "PATCH", "/service/profiles/"+mocks.MockFirstUUID().String(), tContentType, app.testFirstToken(t), tBody)
+			if !assert.Equal(t, http.StatusOK, code, body) {
+				return
+			}
+
+			var response map[string]data.Profile
+			err = json.Unmarshal([]byte(body), &response)
+			assert.Nil(t, err)
+			assert.Equal(t, data.PictureStatusPending, response["profile"].ProfilePictureStatus)
+
+			// A placeholder is served until the picture is approved
+			urlPath := "/service/profiles/pictures/" + response["profile"].ProfilePicture
+
+			code, header, _ := ts.requestHeaders(t, "GET", urlPath, nil)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, data.PictureStatusPending, header.Get("X-Picture-Status"))
+			assert.Equal(t, "no-store", header.Get("Cache-Control"))
+
+			verdicts <- tt.infected
+			app.wg.Wait()
+
+			code, header, _ = ts.requestHeaders(t, "GET", urlPath, nil)
+			assert.Equal(t, http.StatusOK, code)
+
+			if tt.expectedStatus == data.PictureStatusApproved {
+				assert.Empty(t, header.Get("X-Picture-Status"))
+				assert.Equal(t, app.Config.Pictures.CacheControl, header.Get("Cache-Control"))
+				return
+			}
+			assert.Equal(t, tt.expectedStatus, header.Get("X-Picture-Status"))
+		})
+	}
+
+	t.Run("Rescan", func(t *testing.T) {
+		// A failed scan leaves the picture pending
+		name := mocks.MockFirstUUID().String() + ".jpg"
+		err := app.Models.Profiles.UpdatePictureStatus(mocks.MockFirstUUID(), name, data.PictureStatusPending)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go func() {
+			verdicts <- false
+		}()
+
+		scanned, err := app.RescanPendingPictures()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, scanned)
+
+		status, err := app.Models.Profiles.GetPictureStatus(name)
+		assert.Nil(t, err)
+		assert.Equal(t, data.PictureStatusApproved, status)
+	})
+}
+
+func testPictureHistory(t *testing.T, app *Application, ts *httpTestServer) {
+	app.testCopyUploads(t)
+	app.testResetHistory()
+
+	profilePath := "/service/profiles/" + mocks.MockFirstUUID().String()
+	historyPath := profilePath + "/picture/history"
+	firstToken := app.testFirstToken(t)
+
+	// Upload pictures with another content each time, the mock Profile
+	// always has the picture of the test uploads before the update
+	uploads := []string{}
+	for i := 0; i < 3; i++ {
+		img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+		img.Set(0, 0, color.RGBA{G: uint8(i), A: 0xff})
+
+		var content bytes.Buffer
+		err := picture.Encode(&content, img, "png")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tBody, tContentType := app.testForm(t, nil, "profile.png", content.Bytes())
+		code, _, body := ts.request(t, "PATCH", profilePath, tContentType, firstToken, tBody)
+		if !assert.Equal(t, http.StatusOK, code, body) {
+			return
+		}
+
+		var response map[string]data.Profile
+		err = json.Unmarshal([]byte(body), &response)
+		assert.Nil(t, err)
+		uploads = append(uploads, response["profile"].ProfilePicture)
+	}
+
+	oldPicture := mocks.MockFirstUUID().String() + ".jpg"
+
+	t.Run("List", func(t *testing.T) {
+		code, _, body := ts.request(t, "GET", historyPath, "", firstToken, nil)
+		assert.Equal(t, http.StatusOK, code)
+
+		var response map[string][]data.PictureHistory
+		err := json.Unmarshal([]byte(body), &response)
+		assert.Nil(t, err)
+
+		// The history has the old picture of the Profile once,
+		// and the previous picture is still stored
+		if assert.Len(t, response["pictures"], 1) {
+			assert.Equal(t, oldPicture, response["pictures"][0].ProfilePicture)
+			assert.NotEmpty(t, response["pictures"][0].ProfilePictureURL)
+		}
+
+		_, err = app.Storage.Stat(oldPicture)
+		assert.Nil(t, err)
+	})
+
+	t.Run("Forbidden", func(t *testing.T) {
+		code, _, _ := ts.request(t, "GET", historyPath, "", app.testSecondToken(t), nil)
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("Retention", func(t *testing.T) {
+		// Fill the history beyond the retention of two pictures
+		r := httptest.NewRequest("PATCH", profilePath, nil)
+		profile := &data.Profile{ID: mocks.MockFirstUUID()}
+		for _, name := range uploads {
+			err := app.updateProfilePicture(profile, name, data.PictureStatusApproved)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.retireProfilePicture(r, profile, name)
+		}
+
+		entries, err := app.Models.PictureHistory.GetAllByProfile(mocks.MockFirstUUID())
+		assert.Nil(t, err)
+		assert.Len(t, entries, app.Config.Pictures.History)
+
+		// The pictures beyond the retention are deleted
+		for _, name := range []string{oldPicture, uploads[0]} {
+			_, err = app.Storage.Stat(name)
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		entries, err := app.Models.PictureHistory.GetAllByProfile(mocks.MockFirstUUID())
+		if !assert.Nil(t, err) || !assert.NotEmpty(t, entries) {
+			return
+		}
+
+		restored := entries[len(entries)-1]
+		code, _, body := ts.request(t, "POST", historyPath+"/"+restored.ID.String()+"/restore", "", firstToken, nil)
+		assert.Equal(t, http.StatusOK, code)
+
+		var response map[string]data.Profile
+		err = json.Unmarshal([]byte(body), &response)
+		assert.Nil(t, err)
+		assert.Equal(t, restored.ProfilePicture, response["profile"].ProfilePicture)
+
+		// The restored picture is not in the history anymore
+		_, err = app.Models.PictureHistory.GetByID(restored.ID)
+		assert.ErrorIs(t, err, data.ErrRecordNotFound)
+	})
+
+	t.Run("Restore Not Found", func(t *testing.T) {
+		code, _, _ := ts.request(t, "POST", historyPath+"/"+mocks.MockSecondUUID().String()+"/restore", "", firstToken, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func testPictureResize(t *testing.T, app *Application, ts *httpTestServer) {
+	app.testCopyUploads(t)
+
+	file := mocks.MockFirstUUID().String() + ".jpg"
+	urlPath := "/service/profiles/pictures/" + file
+
+	original, err := os.ReadFile("./test/uploads/" + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The contained picture keeps the aspect ratio
+	containWidth, containHeight := 96, 64
+	if config.Width*containHeight > config.Height*containWidth {
+		containHeight = config.Height * containWidth / config.Width
+	} else {
+		containWidth = config.Width * containHeight / config.Height
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedCode   int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{
+			name:           "Cover",
+			query:          "?w=96&h=64&fit=cover",
+			expectedCode:   http.StatusOK,
+			expectedWidth:  96,
+			expectedHeight: 64,
+		},
+		{
+			name:           "Contain",
+			query:          "?w=96&h=64&fit=contain",
+			expectedCode:   http.StatusOK,
+			expectedWidth:  containWidth,
+			expectedHeight: containHeight,
+		},
+		{
+			name:           "Square",
+			query:          "?w=32",
+			expectedCode:   http.StatusOK,
+			expectedWidth:  32,
+			expectedHeight: 32,
+		},
+		{
+			name:         "Not Allowed Size",
+			query:        "?w=100&h=100",
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Invalid Fit",
+			query:        "?w=96&h=96&fit=stretch",
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "With Size",
+			query:        "?w=96&h=96&size=64",
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.requestHeaders(t, "GET", urlPath+tt.query, nil)
+			assert.Equal(t, tt.expectedCode, code)
+
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, "image/jpeg", header.Get("Content-Type"))
+			assert.Equal(t, app.Config.Pictures.CacheControl, header.Get("Cache-Control"))
+
+			config, _, err := image.DecodeConfig(strings.NewReader(body))
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tt.expectedWidth, config.Width)
+			assert.Equal(t, tt.expectedHeight, config.Height)
+		})
+	}
+
+	t.Run("Cached", func(t *testing.T) {
+		// The resized picture is served from the cache
+		size := app.PictureCache.Size()
+		assert.NotZero(t, size)
+
+		code, header, _ := ts.requestHeaders(t, "GET", urlPath+"?w=96&h=64", nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.NotEmpty(t, header.Get("ETag"))
+		assert.Equal(t, size, app.PictureCache.Size())
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		// A cached resize of a deleted picture isn't served
+		code, _, _ := ts.request(t, "DELETE", "/service/profiles/"+mocks.MockFirstUUID().String(), "", app.testFirstToken(t), nil)
+		assert.Equal(t, http.StatusNoContent, code)
+
+		code, _, _ = ts.requestHeaders(t, "GET", urlPath, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+
+		code, _, _ = ts.requestHeaders(t, "GET", urlPath+"?w=96&h=64", nil)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("Avatar", func(t *testing.T) {
+		avatarPath := "/service/profiles/pictures/avatar-" + mocks.MockFirstUUID().String() + ".png"
+
+		code, _, body := ts.requestHeaders(t, "GET", avatarPath+"?w=64", nil)
+		assert.Equal(t, http.StatusOK, code)
+
+		config, _, err := image.DecodeConfig(strings.NewReader(body))
+		if assert.Nil(t, err) {
+			assert.Equal(t, 64, config.Width)
+		}
+
+		code, _, _ = ts.requestHeaders(t, "GET", avatarPath+"?w=64&h=32", nil)
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+	})
+}
+
+func testPictureMetadata(t *testing.T, app *Application, ts *httpTestServer) {
+	app.testCopyUploads(t)
+
+	t.Run("Upload", func(t *testing.T) {
+		tBody, tContentType := app.testFormProfile(t)
+		code, _, body := ts.request(t, "PATCH", "/service/profiles/"+mocks.MockFirstUUID().String(), tContentType, app.testFirstToken(t), tBody)
+		if !assert.Equal(t, http.StatusOK, code, body) {
+			return
+		}
+
+		var response map[string]data.Profile
+		err := json.Unmarshal([]byte(body), &response)
+		assert.Nil(t, err)
+		assert.Len(t, response["profile"].ProfilePictureBlurhash, 28)
+		assert.Regexp(t, "^#[0-9a-f]{6}$", response["profile"].ProfilePictureColor)
+	})
+
+	t.Run("Avatar", func(t *testing.T) {
+		code, _, body := ts.request(t, "DELETE", "/service/profiles/"+mocks.MockFirstUUID().String()+"/picture", "", app.testFirstToken(t), nil)
+		if !assert.Equal(t, http.StatusOK, code, body) {
+			return
+		}
+
+		// The color of a generated avatar is its background
+		var response map[string]data.Profile
+		err := json.Unmarshal([]byte(body), &response)
+		assert.Nil(t, err)
+		assert.Empty(t, response["profile"].ProfilePictureBlurhash)
+		user := mocks.MockFirstUUID()
+		assert.Equal(t, picture.HexColor(picture.AvatarColor(user[:])), response["profile"].ProfilePictureColor)
+	})
+
+	t.Run("Backfill", func(t *testing.T) {
+		app.testCopyUploads(t)
+
+		err := app.BackfillPictureMetadata()
+		assert.Nil(t, err)
+	})
+}
+
+func testProfileDelete(t *testing.T, app *Application, ts *httpTestServer) {
+	profilePicture := mocks.MockFirstUUID().String() + ".jpg"
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		token        string
+		expectedCode int
+	}{
+		{
+			name:         "Forbidden",
+			urlPath:      "/service/profiles/" + mocks.MockFirstUUID().String(),
+			token:        app.testSecondToken(t),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Not Found",
+			urlPath:      "/service/profiles/" + mocks.MockSecondUUID().String(),
+			token:        app.testFirstToken(t),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Me Not Found",
+			urlPath:      "/service/profiles/me",
+			token:        app.testSecondToken(t),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Delete",
+			urlPath:      "/service/profiles/" + mocks.MockFirstUUID().String(),
+			token:        app.testFirstToken(t),
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "Delete Me",
+			urlPath:      "/service/profiles/me",
+			token:        app.testFirstToken(t),
+			expectedCode: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.testCopyUploads(t)
+
+			// A previous picture of the Profile
+			app.testResetHistory()
+			err := app.Storage.Put("history.jpg", strings.NewReader("history"), 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.Models.PictureHistory.Insert(&data.PictureHistory{
+				ProfileID:      mocks.MockFirstUUID(),
+				ProfilePicture: "history.jpg",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			code, _, body := ts.request(t, "DELETE", tt.urlPath, "", tt.token, nil)
+			assert.Equal(t, tt.expectedCode, code)
+
+			files := []string{profilePicture, "history.jpg"}
+			for _, variant := range app.Config.Pictures.Variants {
+				files = append(files, picture.VariantName(profilePicture, variant))
+			}
+
+			for _, name := range files {
+				_, err = app.Storage.Stat(name)
+				if tt.expectedCode == http.StatusNoContent {
+					assert.Empty(t, body)
+					assert.ErrorIs(t, err, storage.ErrNotFound, name)
+				} else {
+					assert.Nil(t, err, name)
+				}
+			}
+		})
+	}
+}
+
+func testProfileVisibility(t *testing.T, app *Application, ts *httpTestServer) {
+	urlPath := "/service/profiles/" + mocks.MockFirstUUID().String()
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		token        string
+		admin        bool
+		expectedCode int
+		expectedFull bool
+	}{
+		{
+			name:         "Anonymous",
+			urlPath:      urlPath,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Other User",
+			urlPath:      urlPath,
+			token:        app.testSecondToken(t),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Owner",
+			urlPath:      urlPath,
+			token:        app.testFirstToken(t),
+			expectedCode: http.StatusOK,
+			expectedFull: true,
+		},
+		{
+			name:         "Admin",
+			urlPath:      urlPath,
+			token:        app.testSecondToken(t),
+			admin:        true,
+			expectedCode: http.StatusOK,
+			expectedFull: true,
+		},
+		{
+			name:         "Not Found",
+			urlPath:      "/service/profiles/" + mocks.MockSecondUUID().String(),
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.Config.Auth.Admins = nil
+			if tt.admin {
+				app.Config.Auth.Admins = []uuid.UUID{mocks.MockSecondUUID()}
+			}
+			defer func() {
+				app.Config.Auth.Admins = nil
+			}()
+
+			code, _, body := ts.request(t, "GET", tt.urlPath, "", tt.token, nil)
+			assert.Equal(t, tt.expectedCode, code)
+
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var response map[string]map[string]interface{}
+			err := json.Unmarshal([]byte(body), &response)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			profile := response["profile"]
+			assert.Equal(t, mocks.MockFirstUUID().String(), profile["id"])
+			assert.NotEmpty(t, profile["profile_name_t"])
+			assert.NotEmpty(t, profile["profile_picture_url_s"])
+
+			// The private fields are only in the full Profile
+			for _, key := range []string{"profile_user_s", "profile_picture_s", "created_at_dt"} {
+				_, ok := profile[key]
+				assert.Equal(t, tt.expectedFull, ok, key)
+			}
+		})
+	}
+}
+
+func testProfileList(t *testing.T, app *Application, ts *httpTestServer) {
+	tests := []struct {
+		name          string
+		query         string
+		token         string
+		expectedCode  int
+		expectedCount int
+		expectedFull  bool
+	}{
+		{
+			name:          "Default",
+			expectedCode:  http.StatusOK,
+			expectedCount: 1,
+		},
+		{
+			name:          "Owner",
+			token:         app.testFirstToken(t),
+			expectedCode:  http.StatusOK,
+			expectedCount: 1,
+			expectedFull:  true,
+		},
+		{
+			name:          "Filters",
+			query:         "?profile_name_t=john&ids=" + mocks.MockFirstUUID().String() + "&page=1&page_size=10&sort=-created_at_dt",
+			expectedCode:  http.StatusOK,
+			expectedCount: 1,
+		},
+		{
+			name:          "No Match",
+			query:         "?profile_name_t=jane",
+			expectedCode:  http.StatusOK,
+			expectedCount: 0,
+		},
+		{
+			name:         "Invalid Sort",
+			query:        "?sort=profile_user_s",
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Invalid Page Size",
+			query:        "?page_size=101",
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Invalid IDs",
+			query:        "?ids=1,2",
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.request(t, "GET", "/service/profiles"+tt.query, "", tt.token, nil)
+			assert.Equal(t, tt.expectedCode, code)
+
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Profiles []map[string]interface{} `json:"profiles"`
+				Metadata data.Metadata            `json:"metadata"`
+			}
+			err := json.Unmarshal([]byte(body), &response)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			assert.Len(t, response.Profiles, tt.expectedCount)
+			assert.Equal(t, tt.expectedCount, response.Metadata.TotalRecords)
+
+			for _, profile := range response.Profiles {
+				_, ok := profile["profile_user_s"]
+				assert.Equal(t, tt.expectedFull, ok)
+			}
+		})
+	}
+}
+
+func testProfileSearch(t *testing.T, app *Application, ts *httpTestServer) {
+	tests := []struct {
+		name              string
+		query             string
+		token             string
+		expectedCode      int
+		expectedCount     int
+		expectedFull      bool
+		expectedHighlight map[string]string
+	}{
+		{
+			name:          "Prefix",
+			query:         "?q=jo",
+			expectedCode:  http.StatusOK,
+			expectedCount: 1,
+			expectedHighlight: map[string]string{
+				"profile_name_t":     "<mark>John</mark> Doe",
+				"profile_headline_t": "Go developer",
+			},
+		},
+		{
+			name:          "Owner",
+			query:         "?q=john+do&page=1&page_size=10",
+			token:         app.testFirstToken(t),
+			expectedCode:  http.StatusOK,
+			expectedCount: 1,
+			expectedFull:  true,
+			expectedHighlight: map[string]string{
+				"profile_name_t": "<mark>John</mark> <mark>Doe</mark>",
+			},
+		},
+		{
+			name:          "Details",
+			query:         "?q=go+jakarta",
+			expectedCode:  http.StatusOK,
+			expectedCount: 1,
+			expectedHighlight: map[string]string{
+				"profile_name_t":     "John Doe",
+				"profile_headline_t": "<mark>Go</mark> developer",
+				"profile_bio_t":      "Builds services in <mark>Go</mark>",
+				"profile_location_t": "<mark>Jakarta</mark>",
+			},
+		},
+		{
+			name:          "No Match",
+			query:         "?q=jane",
+			expectedCode:  http.StatusOK,
+			expectedCount: 0,
+		},
+		{
+			name:         "Missing Query",
+			query:        "?q=+",
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Invalid Sort",
+			query:        "?q=jo&sort=rank",
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.request(t, "GET", "/service/profiles/search"+tt.query, "", tt.token, nil)
+			assert.Equal(t, tt.expectedCode, code)
+
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Results []struct {
+					Profile   map[string]interface{} `json:"profile"`
+					Rank      float64                `json:"rank"`
+					Highlight map[string]string      `json:"highlight"`
+				} `json:"results"`
+				Metadata data.Metadata `json:"metadata"`
+			}
+			err := json.Unmarshal([]byte(body), &response)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			assert.Len(t, response.Results, tt.expectedCount)
+			assert.Equal(t, tt.expectedCount, response.Metadata.TotalRecords)
+
+			for _, result := range response.Results {
+				_, ok := result.Profile["profile_user_s"]
+				assert.Equal(t, tt.expectedFull, ok)
+				assert.Greater(t, result.Rank, 0.0)
+				for field, expected := range tt.expectedHighlight {
+					assert.Equal(t, expected, result.Highlight[field], field)
+				}
+			}
+		})
+	}
+}
+
+func testProfileIndexing(t *testing.T, app *Application, ts *httpTestServer) {
+	app.testCopyUploads(t)
+
+	// A stand-in of Solr records the update commands
+	var mu sync.Mutex
+	commands := []string{}
+	solr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		commands = append(commands, string(body))
+		mu.Unlock()
+	}))
+	defer solr.Close()
+
+	lastCommand := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return commands[len(commands)-1]
+	}
+
+	var err error
+	app.Config.Solr.URL = solr.URL + "/solr"
+	app.Config.Solr.Collection = "profiles"
+	app.Indexer, err = OpenIndexer(app.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		app.Indexer = nil
+	}()
+
+	profileID := mocks.MockFirstUUID().String()
+
+	t.Run("Update", func(t *testing.T) {
+		tBody, tContentType := app.testForm(t, map[string]string{"profile_name_t": "John Doe"}, "", nil)
+		code, _, _ := ts.request(t, "PATCH", "/service/profiles/"+profileID, tContentType, app.testFirstToken(t), tBody)
+		assert.Equal(t, http.StatusOK, code)
+
+		err := app.Indexer.Flush(context.Background())
+		assert.Nil(t, err)
+
+		var docs []map[string]interface{}
+		err = json.Unmarshal([]byte(lastCommand()), &docs)
+		if !assert.Nil(t, err) || !assert.Len(t, docs, 1) {
+			return
+		}
+		assert.Equal(t, profileID, docs[0]["id"])
+		assert.Equal(t, "John Doe", docs[0]["profile_name_t"])
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		code, _, _ := ts.request(t, "DELETE", "/service/profiles/"+profileID, "", app.testFirstToken(t), nil)
+		assert.Equal(t, http.StatusNoContent, code)
+
+		err := app.Indexer.Flush(context.Background())
+		assert.Nil(t, err)
+		assert.JSONEq(t, `{"delete":["`+profileID+`"]}`, lastCommand())
+	})
+
+	t.Run("Reindex", func(t *testing.T) {
+		mu.Lock()
+		commands = commands[:0]
+		mu.Unlock()
+
+		indexed, err := app.Reindex()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, indexed)
+
+		// The Profiles are added, the stale documents deleted, and the changes committed
+		mu.Lock()
+		defer mu.Unlock()
+		if assert.Len(t, commands, 3) {
+			assert.Contains(t, commands[0], profileID)
+			assert.Contains(t, commands[1], "indexed_at_dt:[* TO ")
+			assert.JSONEq(t, `{"commit":{}}`, commands[2])
+		}
+	})
+
+	t.Run("Backfill", func(t *testing.T) {
+		app.testCopyUploads(t)
+
+		mu.Lock()
+		commands = commands[:0]
+		mu.Unlock()
+
+		// The backfilled Profiles are sent before the command exits
+		err := app.BackfillPictureMetadata()
+		assert.Nil(t, err)
+		assert.NotZero(t, app.Indexer.Pending())
+
+		err = app.FlushIndexer()
+		assert.Nil(t, err)
+		assert.Zero(t, app.Indexer.Pending())
+		assert.Contains(t, lastCommand(), profileID)
+	})
+}
+
+func testProfileDetails(t *testing.T, app *Application, ts *httpTestServer) {
+	urlPath := "/service/profiles/" + mocks.MockFirstUUID().String()
+
+	tests := []struct {
+		name          string
+		fields        map[string]string
+		expectedCode  int
+		expectedError string
+	}{
+		{
+			name: "Valid",
+			fields: map[string]string{
+				"profile_headline_t":   "Backend Engineer",
+				"profile_bio_t":        "Go and Postgres",
+				"profile_location_t":   "Jakarta",
+				"profile_website_s":    "https://example.com",
+				"profile_social_links": `[{"type":"github","url":"https://github.com/johndoe"}]`,
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:          "Long Headline",
+			fields:        map[string]string{"profile_headline_t": strings.Repeat("a", 121)},
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedError: "profile_headline_t",
+		},
+		{
+			name:          "Invalid Website",
+			fields:        map[string]string{"profile_website_s": "javascript:alert(1)"},
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedError: "profile_website_s",
+		},
+		{
+			name:          "Invalid Links",
+			fields:        map[string]string{"profile_social_links": `{"type":"github"}`},
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedError: "profile_social_links",
+		},
+		{
+			name:          "Unknown Link Type",
+			fields:        map[string]string{"profile_social_links": `[{"type":"myspace","url":"https://myspace.com/johndoe"}]`},
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedError: "profile_social_links.0.type",
+		},
+		{
+			name:          "Invalid Link URL",
+			fields:        map[string]string{"profile_social_links": `[{"type":"github","url":"github.com/johndoe"}]`},
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedError: "profile_social_links.0.url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tBody, tContentType := app.testForm(t, tt.fields, "", nil)
+			code, _, body := ts.request(t, "PATCH", urlPath, tContentType, app.testFirstToken(t), tBody)
+			assert.Equal(t, tt.expectedCode, code)
+
+			if tt.expectedCode != http.StatusOK {
+				var response struct {
+					Error map[string]string `json:"error"`
+				}
+				err := json.Unmarshal([]byte(body), &response)
+				assert.Nil(t, err)
+				assert.Contains(t, response.Error, tt.expectedError)
+				return
+			}
+
+			var response map[string]data.Profile
+			err := json.Unmarshal([]byte(body), &response)
+			assert.Nil(t, err)
+
+			profile := response["profile"]
+			assert.Equal(t, tt.fields["profile_headline_t"], profile.ProfileHeadline)
+			assert.Equal(t, tt.fields["profile_website_s"], profile.ProfileWebsite)
+			assert.Equal(t, data.SocialLinks{{Type: "github", URL: "https://github.com/johndoe"}}, profile.ProfileSocialLinks)
+		})
+	}
+}
+
+func testProfileAttributes(t *testing.T, app *Application, ts *httpTestServer) {
+	urlPath := "/service/profiles/" + mocks.MockFirstUUID().String()
+
+	tests := []struct {
+		name          string
+		attributes    string
+		expectedCode  int
+		expectedError string
+	}{
+		{
+			name:         "Valid",
+			attributes:   `{"department":"Engineering","team":{"size":5}}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:          "Wrong Type",
+			attributes:    `{"team":{"size":"five"}}`,
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedError: "attributes.team.size",
+		},
+		{
+			name:          "Unknown Attribute",
+			attributes:    `{"salary":100}`,
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedError: "attributes",
+		},
+		{
+			name:          "Not An Object",
+			attributes:    `["Engineering"]`,
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedError: "attributes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tBody, tContentType := app.testForm(t, map[string]string{"attributes": tt.attributes}, "", nil)
+			code, _, body := ts.request(t, "PATCH", urlPath, tContentType, app.testFirstToken(t), tBody)
+			assert.Equal(t, tt.expectedCode, code)
+
+			if tt.expectedCode != http.StatusOK {
+				var response struct {
+					Error map[string]string `json:"error"`
+				}
+				err := json.Unmarshal([]byte(body), &response)
+				assert.Nil(t, err)
+				assert.Contains(t, response.Error, tt.expectedError)
+				return
+			}
+
+			var response struct {
+				Profile struct {
+					Attributes json.RawMessage `json:"attributes"`
+				} `json:"profile"`
+			}
+			err := json.Unmarshal([]byte(body), &response)
+			assert.Nil(t, err)
+			assert.JSONEq(t, tt.attributes, string(response.Profile.Attributes))
+		})
+	}
+
+	t.Run("Without Schema", func(t *testing.T) {
+		schema := app.Attributes
+		app.Attributes = nil
+		defer func() {
+			app.Attributes = schema
+		}()
+
+		tBody, tContentType := app.testForm(t, map[string]string{"attributes": `{"department":"Engineering"}`}, "", nil)
+		code, _, _ := ts.request(t, "PATCH", urlPath, tContentType, app.testFirstToken(t), tBody)
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+	})
+}
+
+func testUploadCORS(t *testing.T, app *Application, ts *httpTestServer) {
+	app.Config.Cors.TrustedOrigins = []string{"https://app.example.com"}
+	defer func() {
+		app.Config.Cors.TrustedOrigins = nil
+	}()
+
+	// The preflight of a PATCH allows the offset header
+	code, header, _ := ts.requestHeaders(t, "OPTIONS", "/service/profiles/uploads/1", http.Header{
+		"Origin":                         {"https://app.example.com"},
+		"Access-Control-Request-Method":  {"PATCH"},
+		"Access-Control-Request-Headers": {"Upload-Offset"},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, header.Get("Access-Control-Allow-Headers"), "Upload-Offset")
+
+	// A browser may read the offset and the location of the upload
+	code, header, _ = ts.requestHeaders(t, "GET", "/service/profiles/health", http.Header{
+		"Origin": {"https://app.example.com"},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Location, Upload-Offset", header.Get("Access-Control-Expose-Headers"))
 }
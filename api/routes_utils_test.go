@@ -8,12 +8,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/e-inwork-com/go-profile-service/internal/data"
 	"github.com/e-inwork-com/go-profile-service/internal/data/mocks"
 	"github.com/e-inwork-com/go-profile-service/internal/jsonlog"
+	"github.com/e-inwork-com/go-profile-service/internal/picture"
+	"github.com/e-inwork-com/go-profile-service/internal/storage"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 )
@@ -21,15 +24,95 @@ import (
 func testApplication(t *testing.T) *Application {
 	var cfg Config
 	cfg.Auth.Secret = "secret"
-	cfg.Uploads = "./test/uploads"
+	cfg.Uploads = t.TempDir()
+	cfg.Pictures.Variants = []int{64, 128}
+	cfg.Pictures.Format = "jpeg"
+	cfg.Pictures.CacheControl = "public, max-age=31536000, immutable"
+	cfg.Pictures.AvatarCacheControl = "public, max-age=3600"
+	cfg.Pictures.MaxBytes = 10 << 20
+	cfg.Pictures.MaxWidth = 8192
+	cfg.Pictures.MaxHeight = 8192
+	cfg.Pictures.MaxPixels = 40_000_000
+	cfg.Pictures.History = 2
+	cfg.Pictures.ResizeSizes = []int{32, 64, 96}
+	cfg.Pictures.Cache.MaxBytes = 1 << 20
 
-	return &Application{
+	cfg.Staging.TTL = time.Hour
+	cfg.Attributes.Schema = "./test/schemas/attributes.json"
+
+	store, err := storage.NewLocal(cfg.Uploads)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stage, err := OpenStaging(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pictureCache, err := OpenPictureCache(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributesSchema, err := OpenAttributesSchema(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := &mocks.PictureHistoryModel{}
+
+	app := &Application{
 		Config: cfg,
 		Logger: jsonlog.New(os.Stdout, jsonlog.LevelInfo),
 		Models: data.Models{
-			Profiles: &mocks.ProfileModel{},
-			Users:    &mocks.UserModel{},
+			Profiles:       &mocks.ProfileModel{History: history},
+			PictureHistory: history,
+			Users:          &mocks.UserModel{},
 		},
+		Storage: store,
+		Staging: stage,
+
+		PictureCache: pictureCache,
+		Attributes:   attributesSchema,
+	}
+
+	// Copy the test uploads, so the tests
+	// don't write to the test folder
+	app.testCopyUploads(t)
+
+	return app
+}
+
+func (app *Application) testCopyUploads(t *testing.T) {
+	entries, err := os.ReadDir("./test/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		buff, err := os.ReadFile("./test/uploads/" + entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = app.Storage.Put(entry.Name(), bytes.NewReader(buff), int64(len(buff)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Create the variants of the picture
+		img, format, err := picture.Decode(buff)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, variant := range app.Config.Pictures.Variants {
+			err = app.putPicture(picture.VariantName(entry.Name(), variant), picture.Square(img, variant), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
 	}
 }
 
@@ -69,6 +152,27 @@ func (ts *httpTestServer) request(t *testing.T, method string, urlPath string, c
 	return rs.StatusCode, rs.Header, string(bd)
 }
 
+func (ts *httpTestServer) requestHeaders(t *testing.T, method string, urlPath string, headers http.Header) (int, http.Header, string) {
+	rq, _ := http.NewRequest(method, ts.URL+urlPath, nil)
+
+	for key, values := range headers {
+		rq.Header[key] = values
+	}
+
+	rs, err := ts.Client().Do(rq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	bd, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bd)
+}
+
 func (app *Application) testCreateToken(t *testing.T, id uuid.UUID) string {
 	// Set Signing Key from the Config Environment
 	signingKey := []byte(app.Config.Auth.Secret)
@@ -140,3 +244,56 @@ func (app *Application) testFormProfile(t *testing.T) (io.Reader, string) {
 
 	return bodyBuf, contentType
 }
+
+func (app *Application) testForm(t *testing.T, fields map[string]string, filename string, content []byte) (io.Reader, string) {
+	bodyBuf := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(bodyBuf)
+
+	// Add fields
+	for key, value := range fields {
+		bodyWriter.WriteField(key, value)
+	}
+
+	// Add picture
+	if filename != "" {
+		fileWriter, err := bodyWriter.CreateFormFile("profile_picture_s", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = fileWriter.Write(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Put on body
+	contentType := bodyWriter.FormDataContentType()
+	bodyWriter.Close()
+
+	return bodyBuf, contentType
+}
+
+// testResetHistory replaces the picture history with an empty one,
+// the mock Profiles add the old pictures to the same history
+func (app *Application) testResetHistory() {
+	history := &mocks.PictureHistoryModel{}
+	app.Models.PictureHistory = history
+	app.Models.Profiles.(*mocks.ProfileModel).History = history
+}
+
+// testListUploads returns the names of the stored files
+func (app *Application) testListUploads(t *testing.T) []string {
+	files, err := app.Storage.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
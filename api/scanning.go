@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/e-inwork-com/go-profile-service/internal/data"
+	"github.com/e-inwork-com/go-profile-service/internal/picture"
+	"github.com/google/uuid"
+)
+
+// newPictureStatus returns the status of a new picture,
+// it is pending until the content scanner has checked it
+func (app *Application) newPictureStatus() string {
+	if app.Scanner == nil {
+		return data.PictureStatusApproved
+	}
+
+	return data.PictureStatusPending
+}
+
+// startPictureScan scans the pending picture of a Profile
+// in the background after the Profile has been saved
+func (app *Application) startPictureScan(profile *data.Profile) {
+	if app.Scanner == nil || profile.ProfilePictureStatus != data.PictureStatusPending {
+		return
+	}
+
+	id, name := profile.ID, profile.ProfilePicture
+	app.background(func() {
+		err := app.scanProfilePicture(id, name)
+		if err != nil {
+			// The picture stays pending, so it is never served unchecked
+			app.Logger.PrintError(err, map[string]string{
+				"picture": name,
+			})
+		}
+	})
+}
+
+// RescanPendingPictures scans the current pictures which are still pending,
+// because their scan has failed or the server has stopped in the middle of it.
+// It returns the number of the pictures which have been checked.
+func (app *Application) RescanPendingPictures() (int, error) {
+	if app.Scanner == nil {
+		return 0, nil
+	}
+
+	profiles, err := app.Models.Profiles.GetAllWithPicture()
+	if err != nil {
+		return 0, err
+	}
+
+	scanned := 0
+	for _, profile := range profiles {
+		if profile.ProfilePictureStatus != data.PictureStatusPending {
+			continue
+		}
+
+		// A failed scan is tried again on the next run
+		err := app.scanProfilePicture(profile.ID, profile.ProfilePicture)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{
+				"picture": profile.ProfilePicture,
+			})
+			continue
+		}
+		scanned++
+	}
+
+	if scanned > 0 {
+		app.Logger.PrintInfo("pending pictures scanned", map[string]string{
+			"pictures": strconv.Itoa(scanned),
+		})
+	}
+
+	return scanned, nil
+}
+
+// scanProfilePicture checks a stored picture with the content scanner,
+// and it approves or rejects the picture of the Profile. A rejected
+// picture is kept in the storage for a review, but it isn't served.
+func (app *Application) scanProfilePicture(id uuid.UUID, name string) error {
+	content, _, err := app.Storage.Get(name)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	ctx := context.Background()
+	if app.Config.Scanner.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, app.Config.Scanner.Timeout)
+		defer cancel()
+	}
+
+	result, err := app.Scanner.Scan(ctx, content)
+	if err != nil {
+		return err
+	}
+
+	status := data.PictureStatusApproved
+	if result.Infected {
+		status = data.PictureStatusRejected
+
+		app.Logger.PrintInfo("picture rejected", map[string]string{
+			"picture":   name,
+			"signature": result.Signature,
+		})
+	}
+
+	// The Profile may have got another picture in the meantime,
+	// then the picture has been moved to the history
+	err = app.Models.Profiles.UpdatePictureStatus(id, name, status)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		err = app.Models.PictureHistory.UpdateStatus(id, name, status)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Send the new status of the current picture to Solr
+	if app.Indexer != nil {
+		profile, err := app.Models.Profiles.GetByID(id)
+		if err != nil {
+			return err
+		}
+		app.indexProfile(profile)
+	}
+
+	return nil
+}
+
+// servePicturePlaceholder serves a placeholder instead of a picture
+// which is not approved, it must not be cached because the URL
+// serves the picture after the approval
+func (app *Application) servePicturePlaceholder(w http.ResponseWriter, r *http.Request, status string, size int) {
+	if size == 0 {
+		size = defaultAvatarSize
+	}
+
+	var buff bytes.Buffer
+	err := picture.Encode(&buff, picture.Placeholder(size), "png")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Picture-Status", status)
+
+	_, err = w.Write(buff.Bytes())
+	if err != nil {
+		app.logError(r, err)
+	}
+}
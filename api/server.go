@@ -8,12 +8,19 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/e-inwork-com/go-profile-service/internal/data"
+	"github.com/e-inwork-com/go-profile-service/internal/diskcache"
+	"github.com/e-inwork-com/go-profile-service/internal/indexer"
 	"github.com/e-inwork-com/go-profile-service/internal/jsonlog"
+	"github.com/e-inwork-com/go-profile-service/internal/scanner"
+	"github.com/e-inwork-com/go-profile-service/internal/staging"
+	"github.com/e-inwork-com/go-profile-service/internal/storage"
+	"github.com/google/uuid"
 
 	_ "github.com/lib/pq"
 )
@@ -36,6 +43,7 @@ type Config struct {
 
 	Auth struct {
 		Secret string
+		Admins []uuid.UUID
 	}
 
 	Limiter struct {
@@ -49,13 +57,77 @@ type Config struct {
 	}
 
 	Uploads string
+
+	Storage struct {
+		Backend string
+		S3      storage.S3Config
+	}
+
+	Pictures struct {
+		Variants           []int
+		Format             string
+		CacheControl       string
+		AvatarCacheControl string
+		MaxBytes           int64
+		MaxWidth           int
+		MaxHeight          int
+		MaxPixels          int64
+		History            int
+		ResizeSizes        []int
+
+		Cache struct {
+			Dir      string
+			MaxBytes int64
+		}
+
+		Signing struct {
+			Enabled bool
+			Secret  string
+			TTL     time.Duration
+		}
+	}
+
+	Scanner struct {
+		Backend      string
+		ClamdAddress string
+		Command      string
+		Timeout      time.Duration
+	}
+
+	Staging struct {
+		TTL         time.Duration
+		MaxSessions int
+	}
+
+	Attributes struct {
+		Schema string
+	}
+
+	Solr struct {
+		URL        string
+		Collection string
+		BatchSize  int
+		Interval   time.Duration
+		Retries    int
+	}
+
+	GC struct {
+		Interval time.Duration
+		Grace    time.Duration
+	}
 }
 
 type Application struct {
-	Config Config
-	Logger *jsonlog.Logger
-	Models data.Models
-	wg     sync.WaitGroup
+	Config       Config
+	Logger       *jsonlog.Logger
+	Models       data.Models
+	Storage      storage.Storage
+	Staging      *staging.Staging
+	Scanner      scanner.Scanner
+	PictureCache *diskcache.Cache
+	Indexer      *indexer.Indexer
+	Attributes   *data.AttributesSchema
+	wg           sync.WaitGroup
 }
 
 func (app *Application) Serve() error {
@@ -69,6 +141,32 @@ func (app *Application) Serve() error {
 
 	shutdownError := make(chan error)
 
+	// Scan the pictures which have been left pending by the last run
+	if app.Scanner != nil {
+		app.background(func() {
+			_, err := app.RescanPendingPictures()
+			if err != nil {
+				app.Logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	// Start sending the changed Profiles to Solr
+	quitIndexer := make(chan struct{})
+	if app.Indexer != nil {
+		app.background(func() {
+			app.runIndexer(quitIndexer)
+		})
+	}
+
+	// Start the background garbage collection of the pictures
+	quitGC := make(chan struct{})
+	if app.Config.GC.Interval > 0 {
+		app.background(func() {
+			app.runGarbageCollector(quitGC)
+		})
+	}
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -90,6 +188,8 @@ func (app *Application) Serve() error {
 			"addr": srv.Addr,
 		})
 
+		close(quitGC)
+		close(quitIndexer)
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
@@ -142,3 +242,83 @@ func OpenDB(cfg Config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// OpenStorage returns the storage backend of the uploaded files
+func OpenStorage(cfg Config) (storage.Storage, error) {
+	switch cfg.Storage.Backend {
+	case "", "local":
+		return storage.NewLocal(cfg.Uploads)
+	case "s3":
+		return storage.NewS3(cfg.Storage.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+// OpenStaging returns the staging area of the resumable uploads,
+// it is a local folder inside the uploads folder
+func OpenStaging(cfg Config) (*staging.Staging, error) {
+	stage, err := staging.New(filepath.Join(cfg.Uploads, ".staging"), cfg.Staging.TTL)
+	if err != nil {
+		return nil, err
+	}
+	stage.MaxSessions = cfg.Staging.MaxSessions
+
+	return stage, nil
+}
+
+// OpenScanner returns the content scanner of the uploaded pictures,
+// the pictures are approved without a scan if the backend is empty
+func OpenScanner(cfg Config) (scanner.Scanner, error) {
+	switch cfg.Scanner.Backend {
+	case "":
+		return nil, nil
+	case "clamd":
+		return scanner.NewClamd(cfg.Scanner.ClamdAddress)
+	case "exec":
+		return scanner.NewExec(cfg.Scanner.Command)
+	default:
+		return nil, fmt.Errorf("unknown scanner backend %q", cfg.Scanner.Backend)
+	}
+}
+
+// OpenPictureCache returns the disk cache of the resized pictures,
+// the pictures are resized on every request if the size is zero
+func OpenPictureCache(cfg Config) (*diskcache.Cache, error) {
+	if cfg.Pictures.Cache.MaxBytes <= 0 {
+		return nil, nil
+	}
+
+	dir := cfg.Pictures.Cache.Dir
+	if dir == "" {
+		dir = filepath.Join(cfg.Uploads, ".cache")
+	}
+
+	return diskcache.New(dir, cfg.Pictures.Cache.MaxBytes)
+}
+
+// OpenIndexer returns the indexer of the Profiles in Solr,
+// the Profiles are not indexed if the URL is empty
+func OpenIndexer(cfg Config) (*indexer.Indexer, error) {
+	if cfg.Solr.URL == "" {
+		return nil, nil
+	}
+
+	solr, err := indexer.NewSolr(cfg.Solr.URL, cfg.Solr.Collection)
+	if err != nil {
+		return nil, err
+	}
+	solr.Retries = cfg.Solr.Retries
+
+	return indexer.New(solr, cfg.Solr.BatchSize, cfg.Solr.Interval), nil
+}
+
+// OpenAttributesSchema returns the JSON Schema of the custom attributes,
+// the Profiles have no attributes if the path is empty
+func OpenAttributesSchema(cfg Config) (*data.AttributesSchema, error) {
+	if cfg.Attributes.Schema == "" {
+		return nil, nil
+	}
+
+	return data.LoadAttributesSchema(cfg.Attributes.Schema)
+}
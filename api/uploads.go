@@ -0,0 +1,263 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/e-inwork-com/go-profile-service/internal/data"
+	"github.com/e-inwork-com/go-profile-service/internal/staging"
+	"github.com/e-inwork-com/go-profile-service/internal/validator"
+)
+
+// createUploadHandler function to start a resumable upload of a picture.
+// The client sends the picture in chunks with PATCH, it can ask for the
+// offset with GET after a failure, and attaches the complete upload
+// to the Profile with the finalize request.
+func (app *Application) createUploadHandler(w http.ResponseWriter, r *http.Request) {
+	// Read the total size of the upload
+	var input struct {
+		Size int64 `json:"size"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the size with the limit of a single upload
+	v := validator.New()
+	v.Check(input.Size > 0, "size", "must be greater than zero")
+	v.Check(input.Size <= app.Config.Pictures.MaxBytes, "size", fmt.Sprintf("must not be larger than %d bytes", app.Config.Pictures.MaxBytes))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Create the upload session of the current user
+	user := app.contextGetUser(r)
+	session, err := app.Staging.Create(user.ID, input.Size)
+	if err != nil {
+		switch {
+		case errors.Is(err, staging.ErrTooMany):
+			app.tooManyUploadsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Send the location of the upload
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/service/profiles/uploads/%s", session.ID))
+	headers.Set("Upload-Offset", "0")
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"upload": session}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getUploadHandler function to get the offset of a resumable upload
+func (app *Application) getUploadHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"upload": session}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// patchUploadHandler function to append a chunk to a resumable upload,
+// the Upload-Offset header has to match the offset of the upload
+func (app *Application) patchUploadHandler(w http.ResponseWriter, r *http.Request) {
+	// Check the content of the request
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		app.badRequestResponse(w, r, errors.New("the Content-Type header must be application/offset+octet-stream"))
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		app.badRequestResponse(w, r, errors.New("the Upload-Offset header must be a non-negative integer"))
+		return
+	}
+
+	session, ok := app.readUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Append the chunk to the staging data
+	session, err = app.Staging.Append(session.ID, offset, r.Body)
+	if err != nil {
+		switch {
+		case errors.Is(err, staging.ErrOffsetConflict):
+			app.uploadOffsetConflictResponse(w, r, session.Offset)
+		case errors.Is(err, staging.ErrTooLarge):
+			app.payloadTooLargeResponse(w, r, session.Size)
+		case errors.Is(err, staging.ErrNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"upload": session}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// finalizeUploadHandler function to attach a complete resumable upload
+// as the picture of the Profile of the current user. The picture is
+// checked like a picture of a multipart form, and the optional crop
+// fields are read from the form of the request.
+func (app *Application) finalizeUploadHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Read the optional crop fields
+	err := r.ParseForm()
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(session.Complete(), "offset", fmt.Sprintf("must be equal to the size of %d bytes", session.Size))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Get the Profile of the current user
+	user := app.contextGetUser(r)
+	profile, err := app.Models.Profiles.GetByProfileUser(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Read and check the uploaded picture
+	buff, err := app.Staging.Read(session.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	upload := app.checkProfilePicture(r, v, buff)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Save the uploaded picture with the variants to the storage
+	saved, err := app.saveProfilePicture(upload)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Update the Profile
+	oldPicture, oldStatus := profile.ProfilePicture, profile.ProfilePictureStatus
+	saved.apply(profile)
+	profile.ProfilePictureStatus = app.newPictureStatus()
+
+	err = app.updateProfilePicture(profile, oldPicture, oldStatus)
+	if err != nil {
+		app.cleanupProfilePicture(r, saved.name)
+
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Prune the picture history, and delete the staging data
+	app.retireProfilePicture(r, profile, oldPicture)
+	app.indexProfile(profile)
+	app.startPictureScan(profile)
+
+	err = app.Staging.Delete(session.ID)
+	if err != nil {
+		app.logError(r, err)
+	}
+
+	// Send back the Profile to the request response
+	app.setProfilePictureURLs(profile)
+	err = app.writeJSON(w, http.StatusOK, envelope{"profile": profile}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteUploadHandler function to cancel a resumable upload
+func (app *Application) deleteUploadHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.Staging.Delete(session.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readUploadSession gets the upload session of the request parameters,
+// it sends an error response and returns false if the session is not
+// available to the current user
+func (app *Application) readUploadSession(w http.ResponseWriter, r *http.Request) (*staging.Session, bool) {
+	// Get ID from the request parameters
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	session, err := app.Staging.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, staging.ErrNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	// Only the user who has started the upload can use it
+	user := app.contextGetUser(r)
+	if session.User != user.ID {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return session, true
+}
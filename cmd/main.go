@@ -1,18 +1,22 @@
 package main
 
 import (
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/e-inwork-com/go-profile-service/api"
 	"github.com/e-inwork-com/go-profile-service/internal/data"
 	"github.com/e-inwork-com/go-profile-service/internal/jsonlog"
+	"github.com/e-inwork-com/go-profile-service/internal/picture"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 
 	_ "github.com/lib/pq"
@@ -33,6 +37,17 @@ func main() {
 	flag.StringVar(&cfg.Env, "env", "development", "Environment (development|staging|production)")
 	flag.StringVar(&cfg.Db.Dsn, "db-dsn", os.Getenv("DBDSN"), "Database DSN")
 	flag.StringVar(&cfg.Auth.Secret, "auth-secret", os.Getenv("AUTHSECRET"), "Authentication Secret")
+	flag.Func("auth-admins", "IDs of the admin users who see the full Profiles (space separated)", func(val string) error {
+		cfg.Auth.Admins = nil
+		for _, field := range strings.Fields(val) {
+			id, err := uuid.Parse(field)
+			if err != nil {
+				return fmt.Errorf("invalid admin user %q", field)
+			}
+			cfg.Auth.Admins = append(cfg.Auth.Admins, id)
+		}
+		return nil
+	})
 	flag.IntVar(&cfg.Db.MaxOpenConn, "db-max-open-conn", 25, "Database max open connections")
 	flag.IntVar(&cfg.Db.MaxIdleConn, "db-max-idle-conn", 25, "Database max idle connections")
 	flag.StringVar(&cfg.Db.MaxIdleTime, "db-max-idle-time", "15m", "Database max connection idle time")
@@ -40,10 +55,59 @@ func main() {
 	flag.Float64Var(&cfg.Limiter.Rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.Limiter.Burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.StringVar(&cfg.Uploads, "uploads", os.Getenv("UPLOADS"), "Uploads folder")
+	flag.StringVar(&cfg.Storage.Backend, "storage", envOr("STORAGE", "local"), "Storage backend of the uploads (local|s3)")
+	flag.StringVar(&cfg.Storage.S3.Endpoint, "s3-endpoint", os.Getenv("S3ENDPOINT"), "S3 endpoint, such as s3.amazonaws.com or localhost:9000")
+	flag.StringVar(&cfg.Storage.S3.AccessKey, "s3-access-key", os.Getenv("S3ACCESSKEY"), "S3 access key")
+	flag.StringVar(&cfg.Storage.S3.SecretKey, "s3-secret-key", os.Getenv("S3SECRETKEY"), "S3 secret key")
+	flag.StringVar(&cfg.Storage.S3.Bucket, "s3-bucket", os.Getenv("S3BUCKET"), "S3 bucket")
+	flag.StringVar(&cfg.Storage.S3.Region, "s3-region", os.Getenv("S3REGION"), "S3 region")
+	flag.BoolVar(&cfg.Storage.S3.UseSSL, "s3-ssl", true, "Use HTTPS for the S3 endpoint")
+	cfg.Pictures.Variants = []int{64, 128, 512}
+	flag.Func("picture-variants", "Sizes of the square picture variants (space separated, default \"64 128 512\")", func(val string) error {
+		cfg.Pictures.Variants, err = parseSizes(val)
+		return err
+	})
+	cfg.Pictures.ResizeSizes = []int{32, 48, 64, 96, 128, 192, 256, 384, 512}
+	flag.Func("picture-resize-sizes", "Allowed widths and heights of the resized pictures (space separated, default \"32 48 64 96 128 192 256 384 512\")", func(val string) error {
+		cfg.Pictures.ResizeSizes, err = parseSizes(val)
+		return err
+	})
+	flag.StringVar(&cfg.Pictures.Cache.Dir, "picture-cache-dir", os.Getenv("PICTURECACHEDIR"), "Folder of the resized pictures (default the .cache folder of the uploads)")
+	flag.Int64Var(&cfg.Pictures.Cache.MaxBytes, "picture-cache-max-bytes", 256<<20, "Maximum size of the resized pictures on disk (0 disables the cache)")
+	flag.StringVar(&cfg.Pictures.Format, "picture-format", "jpeg", "Format of the stored pictures (jpeg|png)")
+	flag.StringVar(&cfg.Pictures.CacheControl, "picture-cache-control", "public, max-age=31536000, immutable", "Cache-Control header of the pictures")
+	flag.StringVar(&cfg.Pictures.AvatarCacheControl, "avatar-cache-control", "public, max-age=3600", "Cache-Control header of the generated avatars")
+	flag.Int64Var(&cfg.Pictures.MaxBytes, "picture-max-bytes", 10<<20, "Maximum size of a picture upload request in bytes")
+	flag.IntVar(&cfg.Pictures.MaxWidth, "picture-max-width", 8192, "Maximum width of an uploaded picture in pixels")
+	flag.IntVar(&cfg.Pictures.MaxHeight, "picture-max-height", 8192, "Maximum height of an uploaded picture in pixels")
+	flag.Int64Var(&cfg.Pictures.MaxPixels, "picture-max-pixels", 40_000_000, "Maximum number of pixels of an uploaded picture")
+	flag.IntVar(&cfg.Pictures.History, "picture-history", 5, "Number of previous pictures kept for a restore (0 deletes them at once)")
+	flag.BoolVar(&cfg.Pictures.Signing.Enabled, "picture-signing", false, "Serve the pictures only from signed URLs")
+	flag.StringVar(&cfg.Pictures.Signing.Secret, "picture-signing-secret", os.Getenv("PICTURESECRET"), "Secret of the signed picture URLs")
+	flag.DurationVar(&cfg.Pictures.Signing.TTL, "picture-signing-ttl", time.Hour, "Minimum lifetime of a signed picture URL")
+	flag.StringVar(&cfg.Scanner.Backend, "scanner", os.Getenv("SCANNER"), "Content scanner of the uploaded pictures (clamd|exec), empty disables it")
+	flag.StringVar(&cfg.Scanner.ClamdAddress, "scanner-clamd-address", envOr("CLAMDADDRESS", "tcp://localhost:3310"), "Address of clamd, such as tcp://localhost:3310 or unix:///run/clamav/clamd.ctl")
+	flag.StringVar(&cfg.Scanner.Command, "scanner-command", os.Getenv("SCANNERCOMMAND"), "Scanner command which reads the picture from stdin and exits with 1 if it is infected")
+	flag.DurationVar(&cfg.Scanner.Timeout, "scanner-timeout", 30*time.Second, "Timeout of a picture scan")
+	flag.DurationVar(&cfg.Staging.TTL, "upload-session-ttl", 24*time.Hour, "Lifetime of a resumable upload session")
+	flag.IntVar(&cfg.Staging.MaxSessions, "upload-max-sessions", 5, "Maximum number of the active upload sessions of a user (0 is no limit)")
+	flag.StringVar(&cfg.Attributes.Schema, "attributes-schema", os.Getenv("ATTRIBUTESSCHEMA"), "JSON Schema file of the custom Profile attributes, empty disables them")
+	flag.StringVar(&cfg.Solr.URL, "solr-url", os.Getenv("SOLRURL"), "Solr URL, such as http://localhost:8983/solr, empty disables the indexing")
+	flag.StringVar(&cfg.Solr.Collection, "solr-collection", envOr("SOLRCOLLECTION", "profiles"), "Solr collection of the Profiles")
+	flag.IntVar(&cfg.Solr.BatchSize, "solr-batch-size", 100, "Maximum number of the Profiles in a Solr update")
+	flag.DurationVar(&cfg.Solr.Interval, "solr-interval", time.Second, "Interval of the Solr updates")
+	flag.IntVar(&cfg.Solr.Retries, "solr-retries", 3, "Number of the retries of a failed Solr update")
+	flag.DurationVar(&cfg.GC.Interval, "gc-interval", time.Hour, "Interval of the orphaned picture garbage collection (0 disables it)")
+	flag.DurationVar(&cfg.GC.Grace, "gc-grace", time.Hour, "Minimum age of an orphaned picture before it is deleted")
 	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
 		cfg.Cors.TrustedOrigins = strings.Fields(val)
 		return nil
 	})
+	collectGarbage := flag.Bool("gc", false, "Delete the orphaned pictures once and exit")
+	dryRun := flag.Bool("gc-dry-run", false, "Only list the orphaned pictures with -gc")
+	migratePictures := flag.Bool("migrate-pictures", false, "Rename the stored pictures to content-derived names and exit")
+	backfillPictures := flag.Bool("backfill-pictures", false, "Compute the blurhash and the dominant color of the stored pictures and exit")
+	reindex := flag.Bool("reindex", false, "Send all the Profiles to Solr and exit")
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 	flag.Parse()
 
@@ -54,6 +118,16 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Check the format of the stored pictures
+	if !picture.IsFormat(cfg.Pictures.Format) {
+		log.Fatalf("Unknown picture format %q", cfg.Pictures.Format)
+	}
+
+	// A signed URL needs a secret
+	if cfg.Pictures.Signing.Enabled && (cfg.Pictures.Signing.Secret == "" || cfg.Pictures.Signing.TTL <= 0) {
+		log.Fatal("Signed picture URLs need a secret and a positive TTL")
+	}
+
 	// Set logger
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
@@ -67,6 +141,47 @@ func main() {
 	// Log a status of the database
 	logger.PrintInfo("database connection pool established", nil)
 
+	// Set Storage
+	store, err := api.OpenStorage(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// Log a status of the storage
+	logger.PrintInfo("storage backend initialized", map[string]string{
+		"backend": cfg.Storage.Backend,
+	})
+
+	// Set the staging area of the resumable uploads
+	stage, err := api.OpenStaging(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// Set the content scanner of the uploaded pictures
+	scan, err := api.OpenScanner(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// Set the disk cache of the resized pictures
+	pictureCache, err := api.OpenPictureCache(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// Set the indexer of the Profiles in Solr
+	profileIndexer, err := api.OpenIndexer(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// Set the JSON Schema of the custom attributes
+	attributesSchema, err := api.OpenAttributesSchema(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	// Publish variables
 	expvar.NewString("version").Set(api.Version)
 	expvar.Publish("goroutines", expvar.Func(func() interface{} {
@@ -81,9 +196,67 @@ func main() {
 
 	// Set the application
 	app := &api.Application{
-		Config: cfg,
-		Logger: logger,
-		Models: data.InitModels(db),
+		Config:       cfg,
+		Logger:       logger,
+		Models:       data.InitModels(db),
+		Storage:      store,
+		Staging:      stage,
+		Scanner:      scan,
+		PictureCache: pictureCache,
+		Indexer:      profileIndexer,
+		Attributes:   attributesSchema,
+	}
+
+	// Migrate the pictures instead of running the server
+	if *migratePictures {
+		err = app.MigratePictures()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		// The indexer isn't running, send the changed Profiles before exiting
+		err = app.FlushIndexer()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		os.Exit(0)
+	}
+
+	// Backfill the placeholder metadata instead of running the server
+	if *backfillPictures {
+		err = app.BackfillPictureMetadata()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		// The indexer isn't running, send the changed Profiles before exiting
+		err = app.FlushIndexer()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		os.Exit(0)
+	}
+
+	// Rebuild the Solr collection instead of running the server
+	if *reindex {
+		if app.Indexer == nil {
+			logger.PrintFatal(errors.New("reindex needs a Solr URL"), nil)
+		}
+
+		_, err = app.Reindex()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		os.Exit(0)
+	}
+
+	// Delete the orphaned pictures instead of running the server
+	if *collectGarbage {
+		_, err = app.CollectGarbage(*dryRun)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		os.Exit(0)
 	}
 
 	// Run the application
@@ -92,3 +265,26 @@ func main() {
 		logger.PrintFatal(err, nil)
 	}
 }
+
+// parseSizes parses a space separated list of sizes in pixels
+func parseSizes(val string) ([]int, error) {
+	sizes := []int{}
+	for _, field := range strings.Fields(val) {
+		size, err := strconv.Atoi(field)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid size %q", field)
+		}
+		sizes = append(sizes, size)
+	}
+
+	return sizes, nil
+}
+
+// envOr returns the environment variable or the fallback if it is not set
+func envOr(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+
+	return fallback
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/e-inwork-com/go-profile-service/internal/validator"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Attributes are the custom fields of a Profile, their names
+// and types are defined by the JSON Schema of the attributes
+type Attributes map[string]interface{}
+
+// MarshalJSON encodes no attributes as an empty object
+func (a Attributes) MarshalJSON() ([]byte, error) {
+	if a == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(map[string]interface{}(a))
+}
+
+// Value encodes the attributes for the database
+func (a Attributes) Value() (driver.Value, error) {
+	return a.MarshalJSON()
+}
+
+// Scan decodes the attributes from the database
+func (a *Attributes) Scan(src interface{}) error {
+	var content []byte
+	switch src := src.(type) {
+	case []byte:
+		content = src
+	case string:
+		content = []byte(src)
+	case nil:
+		*a = Attributes{}
+		return nil
+	default:
+		return errors.New("unsupported type of the attributes")
+	}
+
+	return json.Unmarshal(content, a)
+}
+
+// AttributesSchema is the compiled JSON Schema of the attributes
+type AttributesSchema struct {
+	schema *jsonschema.Schema
+}
+
+// LoadAttributesSchema compiles the JSON Schema in the file
+func LoadAttributesSchema(path string) (*AttributesSchema, error) {
+	schema, err := jsonschema.Compile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttributesSchema{schema: schema}, nil
+}
+
+// ValidateAttributes checks the attributes against the schema, every
+// violation is an error with the path of the attribute in the key, such
+// as "attributes.team.size". Without a schema no attribute is allowed.
+func ValidateAttributes(v *validator.Validator, schema *AttributesSchema, attributes Attributes) {
+	if schema == nil {
+		v.Check(len(attributes) == 0, "attributes", "are not supported")
+		return
+	}
+
+	// The schema sees the same document as the database
+	content, err := json.Marshal(attributes)
+	if err != nil {
+		v.AddError("attributes", "must be a JSON object")
+		return
+	}
+
+	var document interface{}
+	err = json.Unmarshal(content, &document)
+	if err != nil {
+		v.AddError("attributes", "must be a JSON object")
+		return
+	}
+
+	err = schema.schema.Validate(document)
+	if err == nil {
+		return
+	}
+
+	var validationError *jsonschema.ValidationError
+	if !errors.As(err, &validationError) {
+		v.AddError("attributes", err.Error())
+		return
+	}
+
+	addSchemaErrors(v, validationError)
+}
+
+// addSchemaErrors adds the innermost errors of the schema,
+// they explain which attribute is wrong
+func addSchemaErrors(v *validator.Validator, err *jsonschema.ValidationError) {
+	if len(err.Causes) > 0 {
+		for _, cause := range err.Causes {
+			addSchemaErrors(v, cause)
+		}
+		return
+	}
+
+	key := "attributes"
+	if location := strings.Trim(err.InstanceLocation, "/"); location != "" {
+		key += "." + strings.ReplaceAll(location, "/", ".")
+	}
+
+	v.AddError(key, err.Message)
+}
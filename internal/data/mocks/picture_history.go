@@ -0,0 +1,132 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/e-inwork-com/go-profile-service/internal/data"
+	"github.com/google/uuid"
+)
+
+// PictureHistoryModel keeps the history in memory
+type PictureHistoryModel struct {
+	mu      sync.Mutex
+	entries []*data.PictureHistory
+}
+
+func (m *PictureHistoryModel) Insert(entry *data.PictureHistory) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, e := range m.entries {
+		if e.ProfileID == entry.ProfileID && e.ProfilePicture == entry.ProfilePicture {
+			m.entries = append(m.entries[:i], m.entries[i+1:]...)
+			break
+		}
+	}
+
+	entry.ID = uuid.New()
+	entry.CreatedAt = time.Now()
+
+	stored := *entry
+	m.entries = append(m.entries, &stored)
+
+	return nil
+}
+
+func (m *PictureHistoryModel) GetByID(id uuid.UUID) (*data.PictureHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.entries {
+		if e.ID == id {
+			entry := *e
+			return &entry, nil
+		}
+	}
+
+	return nil, data.ErrRecordNotFound
+}
+
+func (m *PictureHistoryModel) GetAllByProfile(profileID uuid.UUID) ([]*data.PictureHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.byProfile(profileID), nil
+}
+
+func (m *PictureHistoryModel) UpdateStatus(profileID uuid.UUID, picture string, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.entries {
+		if e.ProfileID == profileID && e.ProfilePicture == picture {
+			e.ProfilePictureStatus = status
+			return nil
+		}
+	}
+
+	return data.ErrRecordNotFound
+}
+
+func (m *PictureHistoryModel) Delete(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, e := range m.entries {
+		if e.ID == id {
+			m.entries = append(m.entries[:i], m.entries[i+1:]...)
+			return nil
+		}
+	}
+
+	return data.ErrRecordNotFound
+}
+
+func (m *PictureHistoryModel) Prune(profileID uuid.UUID, keep int) ([]*data.PictureHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := m.byProfile(profileID)
+	if len(entries) <= keep {
+		return []*data.PictureHistory{}, nil
+	}
+
+	removed := entries[keep:]
+	for _, r := range removed {
+		for i, e := range m.entries {
+			if e.ID == r.ID {
+				m.entries = append(m.entries[:i], m.entries[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// pictures returns the names of the pictures in the history
+func (m *PictureHistoryModel) pictures() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pictures := []string{}
+	for _, e := range m.entries {
+		pictures = append(pictures, e.ProfilePicture)
+	}
+
+	return pictures
+}
+
+// byProfile returns copies of the entries of a Profile, the latest first
+func (m *PictureHistoryModel) byProfile(profileID uuid.UUID) []*data.PictureHistory {
+	entries := []*data.PictureHistory{}
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if m.entries[i].ProfileID == profileID {
+			entry := *m.entries[i]
+			entries = append(entries, &entry)
+		}
+	}
+
+	return entries
+}
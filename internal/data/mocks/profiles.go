@@ -1,33 +1,51 @@
 package mocks
 
 import (
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/e-inwork-com/go-profile-service/internal/data"
 	"github.com/google/uuid"
 )
 
-type ProfileModel struct{}
+// ProfileModel keeps the status of the pictures, the pictures
+// of the test uploads are approved. Insert and Update return
+// InsertErr and UpdateErr if they are set. The History is
+// the picture history which UpdateWithHistory adds to.
+type ProfileModel struct {
+	InsertErr error
+	UpdateErr error
+	History   *PictureHistoryModel
+
+	pictureStatuses sync.Map
+}
+
+func (m *ProfileModel) Insert(profile *data.Profile) error {
+	if m.InsertErr != nil {
+		return m.InsertErr
+	}
 
-func (m ProfileModel) Insert(profile *data.Profile) error {
 	profile.ID = MockFirstUUID()
 	profile.CreatedAt = time.Now()
 	profile.Version = 1
+	m.setPictureStatus(profile)
 
 	return nil
 }
 
-func (m ProfileModel) GetByID(id uuid.UUID) (*data.Profile, error) {
+func (m *ProfileModel) GetByID(id uuid.UUID) (*data.Profile, error) {
 	profileID := MockFirstUUID()
 
 	if id == profileID {
 		var profile = &data.Profile{
-			ID:             profileID,
-			CreatedAt:      time.Now(),
-			ProfileUser:    MockFirstUUID(),
-			ProfileName:    "John Doe",
-			ProfilePicture: MockFirstUUID().String() + ".jpg",
-			Version:        1,
+			ID:                   profileID,
+			CreatedAt:            time.Now(),
+			ProfileUser:          MockFirstUUID(),
+			ProfileName:          "John Doe",
+			ProfilePicture:       MockFirstUUID().String() + ".jpg",
+			ProfilePictureStatus: data.PictureStatusApproved,
+			Version:              1,
 		}
 		return profile, nil
 	}
@@ -35,17 +53,18 @@ func (m ProfileModel) GetByID(id uuid.UUID) (*data.Profile, error) {
 	return nil, data.ErrRecordNotFound
 }
 
-func (m ProfileModel) GetByProfileUser(profileUser uuid.UUID) (*data.Profile, error) {
+func (m *ProfileModel) GetByProfileUser(profileUser uuid.UUID) (*data.Profile, error) {
 	profileUserID := MockFirstUUID()
 
 	if profileUser == profileUserID {
 		var profile = &data.Profile{
-			ID:             MockFirstUUID(),
-			CreatedAt:      time.Now(),
-			ProfileUser:    profileUserID,
-			ProfileName:    "John Doe",
-			ProfilePicture: MockFirstUUID().String() + ".jpg",
-			Version:        1,
+			ID:                   MockFirstUUID(),
+			CreatedAt:            time.Now(),
+			ProfileUser:          profileUserID,
+			ProfileName:          "John Doe",
+			ProfilePicture:       MockFirstUUID().String() + ".jpg",
+			ProfilePictureStatus: data.PictureStatusApproved,
+			Version:              1,
 		}
 		return profile, nil
 	}
@@ -53,8 +72,157 @@ func (m ProfileModel) GetByProfileUser(profileUser uuid.UUID) (*data.Profile, er
 	return nil, data.ErrRecordNotFound
 }
 
-func (m ProfileModel) Update(profile *data.Profile) error {
+func (m *ProfileModel) Update(profile *data.Profile) error {
+	if m.UpdateErr != nil {
+		return m.UpdateErr
+	}
+
 	profile.Version += 1
+	m.setPictureStatus(profile)
+
+	return nil
+}
+
+func (m *ProfileModel) UpdateWithHistory(profile *data.Profile, entry *data.PictureHistory) error {
+	err := m.Update(profile)
+	if err != nil {
+		return err
+	}
+
+	if entry != nil {
+		return m.History.Insert(entry)
+	}
+
+	return nil
+}
+
+func (m *ProfileModel) Delete(id uuid.UUID) error {
+	if id != MockFirstUUID() {
+		return data.ErrRecordNotFound
+	}
 
 	return nil
 }
+
+func (m *ProfileModel) GetAll(name string, ids []uuid.UUID, filters data.Filters) ([]*data.Profile, data.Metadata, error) {
+	profile, err := m.GetByID(MockFirstUUID())
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	profiles := []*data.Profile{}
+
+	matchesName := strings.Contains(strings.ToLower(profile.ProfileName), strings.ToLower(name))
+	matchesID := len(ids) == 0
+	for _, id := range ids {
+		matchesID = matchesID || id == profile.ID
+	}
+
+	if matchesName && matchesID && filters.Page == 1 {
+		profiles = append(profiles, profile)
+	}
+
+	total := 0
+	if matchesName && matchesID {
+		total = 1
+	}
+
+	return profiles, data.CalculateMetadata(total, filters.Page, filters.PageSize), nil
+}
+
+func (m *ProfileModel) Search(q string, filters data.Filters) ([]*data.ProfileMatch, data.Metadata, error) {
+	profile, err := m.GetByID(MockFirstUUID())
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+
+	// The mock Profile of the search has the details
+	profile.ProfileHeadline = "Go developer"
+	profile.ProfileBio = "Builds services in Go"
+	profile.ProfileLocation = "Jakarta"
+
+	matches := []*data.ProfileMatch{}
+
+	// A word of the searched fields must start with a word of the query
+	found := false
+	text := strings.Join([]string{profile.ProfileName, profile.ProfileHeadline, profile.ProfileBio, profile.ProfileLocation}, " ")
+	for _, word := range data.SearchTerms(text) {
+		for _, term := range data.SearchTerms(q) {
+			found = found || strings.HasPrefix(word, term)
+		}
+	}
+
+	if found && filters.Page == 1 {
+		matches = append(matches, &data.ProfileMatch{Profile: profile, Rank: 1})
+	}
+
+	total := 0
+	if found {
+		total = 1
+	}
+
+	return matches, data.CalculateMetadata(total, filters.Page, filters.PageSize), nil
+}
+
+func (m *ProfileModel) GetAllAfter(createdAt time.Time, id uuid.UUID, limit int) ([]*data.Profile, error) {
+	// The mock Profile is the only one, it is the first page
+	if id != uuid.Nil {
+		return []*data.Profile{}, nil
+	}
+
+	profile, err := m.GetByID(MockFirstUUID())
+	if err != nil {
+		return nil, err
+	}
+
+	return []*data.Profile{profile}, nil
+}
+
+func (m *ProfileModel) GetAllWithPicture() ([]*data.Profile, error) {
+	profile, err := m.GetByID(MockFirstUUID())
+	if err != nil {
+		return nil, err
+	}
+
+	// The status of the picture may have been changed by a scan
+	profile.ProfilePictureStatus, err = m.GetPictureStatus(profile.ProfilePicture)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*data.Profile{profile}, nil
+}
+
+func (m *ProfileModel) GetAllPictures() ([]string, error) {
+	profile, err := m.GetByID(MockFirstUUID())
+	if err != nil {
+		return nil, err
+	}
+
+	return append(m.History.pictures(), profile.ProfilePicture), nil
+}
+
+func (m *ProfileModel) GetPictureStatus(picture string) (string, error) {
+	status, ok := m.pictureStatuses.Load(picture)
+	if !ok {
+		return data.PictureStatusApproved, nil
+	}
+
+	return status.(string), nil
+}
+
+func (m *ProfileModel) UpdatePictureStatus(id uuid.UUID, picture string, status string) error {
+	if id != MockFirstUUID() {
+		return data.ErrRecordNotFound
+	}
+
+	m.pictureStatuses.Store(picture, status)
+
+	return nil
+}
+
+func (m *ProfileModel) setPictureStatus(profile *data.Profile) {
+	if profile.ProfilePicture != "" && profile.ProfilePictureStatus != "" {
+		m.pictureStatuses.Store(profile.ProfilePicture, profile.ProfilePictureStatus)
+	}
+}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -8,11 +9,21 @@ import (
 var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrEditConflict   = errors.New("edit conflict")
+	ErrDuplicateUser  = errors.New("duplicate user")
 )
 
+// uniqueViolation is the Postgres error code of a duplicate key
+const uniqueViolation = "23505"
+
+// queryRower runs a query on the database or in a transaction
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 type Models struct {
-	Profiles ProfileModelInterface
-	Users    UserModelInterface
+	Profiles       ProfileModelInterface
+	PictureHistory PictureHistoryModelInterface
+	Users          UserModelInterface
 }
 
 func InitModels(db *sql.DB) Models {
@@ -20,6 +31,7 @@ func InitModels(db *sql.DB) Models {
 		Profiles: ProfileModel{
 			DB: db,
 		},
-		Users: UserModel{DB: db},
+		PictureHistory: PictureHistoryModel{DB: db},
+		Users:          UserModel{DB: db},
 	}
 }
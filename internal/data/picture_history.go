@@ -0,0 +1,222 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PictureHistoryModelInterface interface {
+	Insert(entry *PictureHistory) error
+	GetByID(id uuid.UUID) (*PictureHistory, error)
+	GetAllByProfile(profileID uuid.UUID) ([]*PictureHistory, error)
+	UpdateStatus(profileID uuid.UUID, picture string, status string) error
+	Delete(id uuid.UUID) error
+	Prune(profileID uuid.UUID, keep int) ([]*PictureHistory, error)
+}
+
+// PictureHistory is a previous picture of a Profile,
+// the file is kept in the storage so it can be restored
+type PictureHistory struct {
+	ID                   uuid.UUID `json:"id"`
+	CreatedAt            time.Time `json:"created_at_dt"`
+	ProfileID            uuid.UUID `json:"-"`
+	ProfilePicture       string    `json:"profile_picture_s"`
+	ProfilePictureStatus string    `json:"profile_picture_status_s"`
+
+	// URLs of the picture endpoint, they are set by the API
+	// and not stored in the database
+	ProfilePictureURL      string            `json:"profile_picture_url_s,omitempty"`
+	ProfilePictureVariants map[string]string `json:"profile_picture_variants,omitempty"`
+}
+
+type PictureHistoryModel struct {
+	DB *sql.DB
+}
+
+// Insert function to add a picture to the history of a Profile,
+// a picture which is already in the history becomes the latest one
+func (m PictureHistoryModel) Insert(entry *PictureHistory) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertPictureHistory(ctx, m.DB, entry)
+}
+
+// insertPictureHistory runs the SQL Insert of a picture history entry,
+// so it can be a part of the transaction of a Profile update
+func insertPictureHistory(ctx context.Context, db queryRower, entry *PictureHistory) error {
+	query := `
+        INSERT INTO picture_history (history_profile_s, history_picture_s, history_picture_status_s)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (history_profile_s, history_picture_s)
+        DO UPDATE SET created_at_dt = NOW(), history_picture_status_s = EXCLUDED.history_picture_status_s
+        RETURNING id, created_at_dt`
+
+	args := []interface{}{entry.ProfileID, entry.ProfilePicture, entry.ProfilePictureStatus}
+
+	return db.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// GetByID function to get a picture of the history
+func (m PictureHistoryModel) GetByID(id uuid.UUID) (*PictureHistory, error) {
+	query := `
+        SELECT id, created_at_dt, history_profile_s, history_picture_s, history_picture_status_s
+        FROM picture_history
+        WHERE id = $1`
+
+	var entry PictureHistory
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&entry.ID,
+		&entry.CreatedAt,
+		&entry.ProfileID,
+		&entry.ProfilePicture,
+		&entry.ProfilePictureStatus,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &entry, nil
+}
+
+// GetAllByProfile function to get the picture history
+// of a Profile, the latest picture first
+func (m PictureHistoryModel) GetAllByProfile(profileID uuid.UUID) ([]*PictureHistory, error) {
+	query := `
+        SELECT id, created_at_dt, history_profile_s, history_picture_s, history_picture_status_s
+        FROM picture_history
+        WHERE history_profile_s = $1
+        ORDER BY created_at_dt DESC, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPictureHistory(rows)
+}
+
+// UpdateStatus function to set the status of a picture which
+// has been moved to the history before it has been scanned
+func (m PictureHistoryModel) UpdateStatus(profileID uuid.UUID, picture string, status string) error {
+	query := `
+        UPDATE picture_history
+        SET history_picture_status_s = $1
+        WHERE history_profile_s = $2 AND history_picture_s = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, status, profileID, picture)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Delete function to remove a picture from the history
+func (m PictureHistoryModel) Delete(id uuid.UUID) error {
+	query := `
+        DELETE FROM picture_history
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Prune function to keep only the latest pictures in the history
+// of a Profile, it returns the removed pictures so their files
+// can be deleted
+func (m PictureHistoryModel) Prune(profileID uuid.UUID, keep int) ([]*PictureHistory, error) {
+	query := `
+        DELETE FROM picture_history
+        WHERE id IN (
+            SELECT id
+            FROM picture_history
+            WHERE history_profile_s = $1
+            ORDER BY created_at_dt DESC, id
+            OFFSET $2)
+        RETURNING id, created_at_dt, history_profile_s, history_picture_s, history_picture_status_s`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, profileID, keep)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPictureHistory(rows)
+}
+
+// scanPictureHistory reads the rows of a picture history query
+func scanPictureHistory(rows *sql.Rows) ([]*PictureHistory, error) {
+	entries := []*PictureHistory{}
+
+	for rows.Next() {
+		var entry PictureHistory
+
+		err := rows.Scan(
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.ProfileID,
+			&entry.ProfilePicture,
+			&entry.ProfilePictureStatus,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
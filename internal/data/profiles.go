@@ -4,11 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/e-inwork-com/go-profile-service/internal/validator"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type ProfileModelInterface interface {
@@ -16,19 +20,95 @@ type ProfileModelInterface interface {
 	GetByID(id uuid.UUID) (*Profile, error)
 	GetByProfileUser(profileUser uuid.UUID) (*Profile, error)
 	Update(profile *Profile) error
+	UpdateWithHistory(profile *Profile, entry *PictureHistory) error
+	Delete(id uuid.UUID) error
+	GetAll(name string, ids []uuid.UUID, filters Filters) ([]*Profile, Metadata, error)
+	Search(q string, filters Filters) ([]*ProfileMatch, Metadata, error)
+	GetAllWithPicture() ([]*Profile, error)
+	GetAllPictures() ([]string, error)
+	GetAllAfter(createdAt time.Time, id uuid.UUID, limit int) ([]*Profile, error)
+	GetPictureStatus(picture string) (string, error)
+	UpdatePictureStatus(id uuid.UUID, picture string, status string) error
 }
 
+// The states of an uploaded picture, a picture is pending until
+// the content scanner has checked it, and only an approved
+// picture is served
+const (
+	PictureStatusPending  = "pending"
+	PictureStatusApproved = "approved"
+	PictureStatusRejected = "rejected"
+)
+
 type Profile struct {
-	ID             uuid.UUID `json:"id"`
-	CreatedAt      time.Time `json:"created_at_dt"`
-	ProfileUser    uuid.UUID `json:"profile_user_s"`
-	ProfileName    string    `json:"profile_name_t"`
-	ProfilePicture string    `json:"profile_picture_s"`
-	Version        int       `json:"-"`
+	ID                     uuid.UUID   `json:"id"`
+	CreatedAt              time.Time   `json:"created_at_dt"`
+	ProfileUser            uuid.UUID   `json:"profile_user_s"`
+	ProfileName            string      `json:"profile_name_t"`
+	ProfilePicture         string      `json:"profile_picture_s"`
+	ProfilePictureStatus   string      `json:"profile_picture_status_s,omitempty"`
+	ProfilePictureBlurhash string      `json:"profile_picture_blurhash_s,omitempty"`
+	ProfilePictureColor    string      `json:"profile_picture_color_s,omitempty"`
+	ProfileHeadline        string      `json:"profile_headline_t"`
+	ProfileBio             string      `json:"profile_bio_t"`
+	ProfileLocation        string      `json:"profile_location_t"`
+	ProfileWebsite         string      `json:"profile_website_s"`
+	ProfileSocialLinks     SocialLinks `json:"profile_social_links"`
+	Attributes             Attributes  `json:"attributes"`
+	Version                int         `json:"-"`
+
+	// URLs of the picture endpoint, they are set by the API
+	// and not stored in the database
+	ProfilePictureURL      string            `json:"profile_picture_url_s,omitempty"`
+	ProfilePictureVariants map[string]string `json:"profile_picture_variants,omitempty"`
+}
+
+// PublicProfile is the projection of a Profile which is shown
+// to everyone except the owner of the Profile and the admins
+type PublicProfile struct {
+	ID                     uuid.UUID         `json:"id"`
+	ProfileName            string            `json:"profile_name_t"`
+	ProfilePictureURL      string            `json:"profile_picture_url_s,omitempty"`
+	ProfilePictureVariants map[string]string `json:"profile_picture_variants,omitempty"`
+	ProfilePictureBlurhash string            `json:"profile_picture_blurhash_s,omitempty"`
+	ProfilePictureColor    string            `json:"profile_picture_color_s,omitempty"`
+	ProfileHeadline        string            `json:"profile_headline_t"`
+	ProfileBio             string            `json:"profile_bio_t"`
+	ProfileLocation        string            `json:"profile_location_t"`
+	ProfileWebsite         string            `json:"profile_website_s"`
+	ProfileSocialLinks     SocialLinks       `json:"profile_social_links"`
+}
+
+// Public returns the public projection of the Profile
+func (p *Profile) Public() *PublicProfile {
+	return &PublicProfile{
+		ID:                     p.ID,
+		ProfileName:            p.ProfileName,
+		ProfilePictureURL:      p.ProfilePictureURL,
+		ProfilePictureVariants: p.ProfilePictureVariants,
+		ProfilePictureBlurhash: p.ProfilePictureBlurhash,
+		ProfilePictureColor:    p.ProfilePictureColor,
+		ProfileHeadline:        p.ProfileHeadline,
+		ProfileBio:             p.ProfileBio,
+		ProfileLocation:        p.ProfileLocation,
+		ProfileWebsite:         p.ProfileWebsite,
+		ProfileSocialLinks:     p.ProfileSocialLinks,
+	}
 }
 
 func ValidateProfile(v *validator.Validator, profile *Profile) {
 	v.Check(profile.ProfileName != "", "profile_name_t", "must be provided")
+
+	v.Check(utf8.RuneCountInString(profile.ProfileHeadline) <= 120, "profile_headline_t", "must not be more than 120 characters long")
+	v.Check(utf8.RuneCountInString(profile.ProfileBio) <= 2000, "profile_bio_t", "must not be more than 2000 characters long")
+	v.Check(utf8.RuneCountInString(profile.ProfileLocation) <= 100, "profile_location_t", "must not be more than 100 characters long")
+
+	if profile.ProfileWebsite != "" {
+		v.Check(len(profile.ProfileWebsite) <= 2048, "profile_website_s", "must not be more than 2048 bytes long")
+		v.Check(validator.IsURL(profile.ProfileWebsite), "profile_website_s", "must be an http or https URL")
+	}
+
+	ValidateSocialLinks(v, profile.ProfileSocialLinks)
 }
 
 type ProfileModel struct {
@@ -37,18 +117,39 @@ type ProfileModel struct {
 
 func (m ProfileModel) Insert(profile *Profile) error {
 	query := `
-        INSERT INTO profiles (profile_user_s, profile_name_t, profile_picture_s)
-        VALUES ($1, $2, $3)
+        INSERT INTO profiles (profile_user_s, profile_name_t, profile_picture_s, profile_picture_status_s,
+            profile_picture_blurhash_s, profile_picture_color_s, profile_headline_t, profile_bio_t,
+            profile_location_t, profile_website_s, profile_social_links, attributes)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
         RETURNING id, created_at_dt, version`
 
-	args := []interface{}{profile.ProfileUser, profile.ProfileName, profile.ProfilePicture}
+	args := []interface{}{
+		profile.ProfileUser,
+		profile.ProfileName,
+		profile.ProfilePicture,
+		profile.ProfilePictureStatus,
+		profile.ProfilePictureBlurhash,
+		profile.ProfilePictureColor,
+		profile.ProfileHeadline,
+		profile.ProfileBio,
+		profile.ProfileLocation,
+		profile.ProfileWebsite,
+		profile.ProfileSocialLinks,
+		profile.Attributes,
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&profile.ID, &profile.CreatedAt, &profile.Version)
 	if err != nil {
-		return err
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == "profiles_profile_user_s_key":
+			return ErrDuplicateUser
+		default:
+			return err
+		}
 	}
 
 	return nil
@@ -56,7 +157,9 @@ func (m ProfileModel) Insert(profile *Profile) error {
 
 func (m ProfileModel) GetByID(id uuid.UUID) (*Profile, error) {
 	query := `
-        SELECT id, created_at_dt, profile_user_s, profile_name_t, profile_picture_s, version
+        SELECT id, created_at_dt, profile_user_s, profile_name_t, profile_picture_s, profile_picture_status_s,
+            profile_picture_blurhash_s, profile_picture_color_s, profile_headline_t,
+            profile_bio_t, profile_location_t, profile_website_s, profile_social_links, attributes, version
         FROM profiles
         WHERE id = $1`
 
@@ -71,6 +174,15 @@ func (m ProfileModel) GetByID(id uuid.UUID) (*Profile, error) {
 		&profile.ProfileUser,
 		&profile.ProfileName,
 		&profile.ProfilePicture,
+		&profile.ProfilePictureStatus,
+		&profile.ProfilePictureBlurhash,
+		&profile.ProfilePictureColor,
+		&profile.ProfileHeadline,
+		&profile.ProfileBio,
+		&profile.ProfileLocation,
+		&profile.ProfileWebsite,
+		&profile.ProfileSocialLinks,
+		&profile.Attributes,
 		&profile.Version,
 	)
 
@@ -90,7 +202,9 @@ func (m ProfileModel) GetByID(id uuid.UUID) (*Profile, error) {
 func (m ProfileModel) GetByProfileUser(profileUser uuid.UUID) (*Profile, error) {
 	// Select query by owner
 	query := `
-        SELECT id, created_at_dt, profile_user_s, profile_name_t, profile_picture_s, version
+        SELECT id, created_at_dt, profile_user_s, profile_name_t, profile_picture_s, profile_picture_status_s,
+            profile_picture_blurhash_s, profile_picture_color_s, profile_headline_t,
+            profile_bio_t, profile_location_t, profile_website_s, profile_social_links, attributes, version
         FROM profiles
         WHERE profile_user_s = $1`
 
@@ -110,6 +224,15 @@ func (m ProfileModel) GetByProfileUser(profileUser uuid.UUID) (*Profile, error)
 		&profile.ProfileUser,
 		&profile.ProfileName,
 		&profile.ProfilePicture,
+		&profile.ProfilePictureStatus,
+		&profile.ProfilePictureBlurhash,
+		&profile.ProfilePictureColor,
+		&profile.ProfileHeadline,
+		&profile.ProfileBio,
+		&profile.ProfileLocation,
+		&profile.ProfileWebsite,
+		&profile.ProfileSocialLinks,
+		&profile.Attributes,
 		&profile.Version,
 	)
 
@@ -129,27 +252,74 @@ func (m ProfileModel) GetByProfileUser(profileUser uuid.UUID) (*Profile, error)
 
 // Update function to update the Profile
 func (m ProfileModel) Update(profile *Profile) error {
+	// Create a context of the SQL Update
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return updateProfile(ctx, m.DB, profile)
+}
+
+// UpdateWithHistory function to update a Profile, and to add its old
+// picture to the history in the same transaction. Otherwise the old
+// picture wouldn't be referenced by any table in between, and
+// the garbage collector could delete it.
+func (m ProfileModel) UpdateWithHistory(profile *Profile, entry *PictureHistory) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateProfile(ctx, tx, profile)
+	if err != nil {
+		return err
+	}
+
+	if entry != nil {
+		err = insertPictureHistory(ctx, tx, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// updateProfile runs the SQL Update of a Profile,
+// the version protects it against a concurrent update
+func updateProfile(ctx context.Context, db queryRower, profile *Profile) error {
 	// SQL Update
 	query := `
         UPDATE profiles
-        SET profile_name_t = $1, profile_picture_s = $2, version = version + 1
-        WHERE id = $3 AND version = $4
+        SET profile_name_t = $1, profile_picture_s = $2, profile_picture_status_s = $3,
+            profile_picture_blurhash_s = $4, profile_picture_color_s = $5, profile_headline_t = $6,
+            profile_bio_t = $7, profile_location_t = $8, profile_website_s = $9, profile_social_links = $10,
+            attributes = $11, version = version + 1
+        WHERE id = $12 AND version = $13
         RETURNING version`
 
 	// Assign arguments
 	args := []interface{}{
 		profile.ProfileName,
 		profile.ProfilePicture,
+		profile.ProfilePictureStatus,
+		profile.ProfilePictureBlurhash,
+		profile.ProfilePictureColor,
+		profile.ProfileHeadline,
+		profile.ProfileBio,
+		profile.ProfileLocation,
+		profile.ProfileWebsite,
+		profile.ProfileSocialLinks,
+		profile.Attributes,
 		profile.ID,
 		profile.Version,
 	}
 
-	// Create a context of the SQL Update
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	// Run SQL Update
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&profile.Version)
+	err := db.QueryRowContext(ctx, query, args...).Scan(&profile.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -161,3 +331,395 @@ func (m ProfileModel) Update(profile *Profile) error {
 
 	return nil
 }
+
+// Delete function to remove a Profile
+func (m ProfileModel) Delete(id uuid.UUID) error {
+	query := `
+        DELETE FROM profiles
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll function to get a page of the Profiles. The name matches a part
+// of the Profile name without the case, and the IDs select the Profiles,
+// an empty name or an empty list of IDs doesn't filter.
+func (m ProfileModel) GetAll(name string, ids []uuid.UUID, filters Filters) ([]*Profile, Metadata, error) {
+	// The sort column has been checked against the safelist,
+	// and the ID keeps the order of the pages stable
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at_dt, profile_user_s, profile_name_t, profile_picture_s,
+            profile_picture_status_s, profile_picture_blurhash_s, profile_picture_color_s, profile_headline_t,
+            profile_bio_t, profile_location_t, profile_website_s, profile_social_links, attributes, version
+        FROM profiles
+        WHERE (profile_name_t ILIKE '%%' || $1 || '%%' OR $1 = '')
+        AND (cardinality($2::uuid[]) = 0 OR id = ANY($2::uuid[]))
+        ORDER BY %s %s, id ASC
+        LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	profileIDs := make([]string, len(ids))
+	for i, id := range ids {
+		profileIDs[i] = id.String()
+	}
+
+	args := []interface{}{likeEscaper.Replace(name), pq.Array(profileIDs), filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	profiles := []*Profile{}
+
+	for rows.Next() {
+		var profile Profile
+
+		err := rows.Scan(
+			&totalRecords,
+			&profile.ID,
+			&profile.CreatedAt,
+			&profile.ProfileUser,
+			&profile.ProfileName,
+			&profile.ProfilePicture,
+			&profile.ProfilePictureStatus,
+			&profile.ProfilePictureBlurhash,
+			&profile.ProfilePictureColor,
+			&profile.ProfileHeadline,
+			&profile.ProfileBio,
+			&profile.ProfileLocation,
+			&profile.ProfileWebsite,
+			&profile.ProfileSocialLinks,
+			&profile.Attributes,
+			&profile.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		profiles = append(profiles, &profile)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return profiles, metadata, nil
+}
+
+// Search function to find the Profiles by the words of their text fields,
+// which start with the words of the query, and by the similarity of the
+// name for the misspelled names. The results are ranked by both.
+func (m ProfileModel) Search(q string, filters Filters) ([]*ProfileMatch, Metadata, error) {
+	// The sort column has been checked against the safelist,
+	// the rank is the default order
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at_dt, profile_user_s, profile_name_t, profile_picture_s,
+            profile_picture_status_s, profile_picture_blurhash_s, profile_picture_color_s, profile_headline_t,
+            profile_bio_t, profile_location_t, profile_website_s, profile_social_links, attributes, version,
+            ts_rank(profile_search_tsv, to_tsquery('simple', $2))
+                + greatest(similarity(profile_name_t, $1), word_similarity($1, profile_name_t)) AS rank
+        FROM profiles
+        WHERE ($2 <> '' AND profile_search_tsv @@ to_tsquery('simple', $2))
+        OR profile_name_t %% $1
+        OR $1 <%% profile_name_t
+        ORDER BY %s %s, id ASC
+        LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	args := []interface{}{q, prefixQuery(SearchTerms(q)), filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	matches := []*ProfileMatch{}
+
+	for rows.Next() {
+		var profile Profile
+		var match = ProfileMatch{Profile: &profile}
+
+		err := rows.Scan(
+			&totalRecords,
+			&profile.ID,
+			&profile.CreatedAt,
+			&profile.ProfileUser,
+			&profile.ProfileName,
+			&profile.ProfilePicture,
+			&profile.ProfilePictureStatus,
+			&profile.ProfilePictureBlurhash,
+			&profile.ProfilePictureColor,
+			&profile.ProfileHeadline,
+			&profile.ProfileBio,
+			&profile.ProfileLocation,
+			&profile.ProfileWebsite,
+			&profile.ProfileSocialLinks,
+			&profile.Attributes,
+			&profile.Version,
+			&match.Rank,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		matches = append(matches, &match)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return matches, metadata, nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// GetAllAfter function to get the next Profiles in the order of the creation,
+// after the Profile with the creation time and the ID. The keyset doesn't
+// skip a Profile when the Profiles before it are inserted or deleted.
+func (m ProfileModel) GetAllAfter(createdAt time.Time, id uuid.UUID, limit int) ([]*Profile, error) {
+	query := `
+        SELECT id, created_at_dt, profile_user_s, profile_name_t, profile_picture_s, profile_picture_status_s,
+            profile_picture_blurhash_s, profile_picture_color_s, profile_headline_t,
+            profile_bio_t, profile_location_t, profile_website_s, profile_social_links, attributes, version
+        FROM profiles
+        WHERE (created_at_dt, id) > ($1, $2)
+        ORDER BY created_at_dt, id
+        LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, createdAt, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []*Profile{}
+
+	for rows.Next() {
+		var profile Profile
+
+		err := rows.Scan(
+			&profile.ID,
+			&profile.CreatedAt,
+			&profile.ProfileUser,
+			&profile.ProfileName,
+			&profile.ProfilePicture,
+			&profile.ProfilePictureStatus,
+			&profile.ProfilePictureBlurhash,
+			&profile.ProfilePictureColor,
+			&profile.ProfileHeadline,
+			&profile.ProfileBio,
+			&profile.ProfileLocation,
+			&profile.ProfileWebsite,
+			&profile.ProfileSocialLinks,
+			&profile.Attributes,
+			&profile.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		profiles = append(profiles, &profile)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// GetAllPictures function to get the names of all the pictures of the
+// Profiles and their picture history, the garbage collector must keep them.
+// One query reads both tables in the same snapshot, so a picture which
+// is moved to the history in between is always seen.
+func (m ProfileModel) GetAllPictures() ([]string, error) {
+	query := `
+        SELECT profile_picture_s
+        FROM profiles
+        WHERE profile_picture_s <> ''
+        UNION
+        SELECT history_picture_s
+        FROM picture_history`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pictures := []string{}
+
+	for rows.Next() {
+		var picture string
+
+		err := rows.Scan(&picture)
+		if err != nil {
+			return nil, err
+		}
+
+		pictures = append(pictures, picture)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pictures, nil
+}
+
+// GetAllWithPicture function to get all Profiles which have a picture
+func (m ProfileModel) GetAllWithPicture() ([]*Profile, error) {
+	// Select query of the Profiles with a picture
+	query := `
+        SELECT id, created_at_dt, profile_user_s, profile_name_t, profile_picture_s, profile_picture_status_s,
+            profile_picture_blurhash_s, profile_picture_color_s, profile_headline_t,
+            profile_bio_t, profile_location_t, profile_website_s, profile_social_links, attributes, version
+        FROM profiles
+        WHERE profile_picture_s <> ''
+        ORDER BY created_at_dt`
+
+	// Create a context of the SQL Select,
+	// it has to read the whole table
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []*Profile{}
+
+	for rows.Next() {
+		var profile Profile
+
+		err := rows.Scan(
+			&profile.ID,
+			&profile.CreatedAt,
+			&profile.ProfileUser,
+			&profile.ProfileName,
+			&profile.ProfilePicture,
+			&profile.ProfilePictureStatus,
+			&profile.ProfilePictureBlurhash,
+			&profile.ProfilePictureColor,
+			&profile.ProfileHeadline,
+			&profile.ProfileBio,
+			&profile.ProfileLocation,
+			&profile.ProfileWebsite,
+			&profile.ProfileSocialLinks,
+			&profile.Attributes,
+			&profile.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		profiles = append(profiles, &profile)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// GetPictureStatus function to get the status of a current
+// or a previous picture by the name of the file
+func (m ProfileModel) GetPictureStatus(picture string) (string, error) {
+	query := `
+        SELECT profile_picture_status_s
+        FROM profiles
+        WHERE profile_picture_s = $1
+        UNION ALL
+        SELECT history_picture_status_s
+        FROM picture_history
+        WHERE history_picture_s = $1
+        LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var status string
+	err := m.DB.QueryRowContext(ctx, query, picture).Scan(&status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return status, nil
+}
+
+// UpdatePictureStatus function to set the status of the picture
+// of a Profile, it doesn't change a Profile which has got
+// another picture in the meantime
+func (m ProfileModel) UpdatePictureStatus(id uuid.UUID, picture string, status string) error {
+	// The version is changed, so a concurrent update
+	// doesn't overwrite the status with an old one
+	query := `
+        UPDATE profiles
+        SET profile_picture_status_s = $1, version = version + 1
+        WHERE id = $2 AND profile_picture_s = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, status, id, picture)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// ProfileMatch is a Profile found by a search, with the rank
+// of the full-text match and the similarity of the name
+type ProfileMatch struct {
+	Profile *Profile
+	Rank    float64
+}
+
+// SearchTerms splits a search query into the lower case words,
+// the other characters can't be used in a query
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// prefixQuery returns a tsquery which matches the words
+// starting with every term, such as "jo:* & do:*"
+func prefixQuery(terms []string) string {
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+
+	return strings.Join(prefixes, " & ")
+}
+
+// Highlight escapes the text for HTML, and marks the words
+// which start with one of the terms with <mark>
+func Highlight(text string, terms []string) string {
+	var result strings.Builder
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		// Copy the characters between the words
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			result.WriteString(html.EscapeString(string(runes[i])))
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			j++
+		}
+		word := string(runes[i:j])
+
+		if matchesTerm(word, terms) {
+			result.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		} else {
+			result.WriteString(html.EscapeString(word))
+		}
+		i = j
+	}
+
+	return result.String()
+}
+
+// matchesTerm checks if the word starts with one of the terms
+func matchesTerm(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+
+	return false
+}
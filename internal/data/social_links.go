@@ -0,0 +1,78 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/e-inwork-com/go-profile-service/internal/validator"
+)
+
+// SocialLinkTypes are the types of the social links,
+// the clients show an icon for each type
+var SocialLinkTypes = []string{
+	"github", "gitlab", "linkedin", "twitter", "mastodon",
+	"stackoverflow", "youtube", "instagram", "facebook", "other",
+}
+
+// SocialLink is a link to a profile of the user on another site
+type SocialLink struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// SocialLinks is the list of the social links of a Profile,
+// it is stored as a JSON array
+type SocialLinks []SocialLink
+
+// MarshalJSON encodes no links as an empty array
+func (l SocialLinks) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal([]SocialLink(l))
+}
+
+// Value encodes the links for the database
+func (l SocialLinks) Value() (driver.Value, error) {
+	return l.MarshalJSON()
+}
+
+// Scan decodes the links from the database
+func (l *SocialLinks) Scan(src interface{}) error {
+	var content []byte
+	switch src := src.(type) {
+	case []byte:
+		content = src
+	case string:
+		content = []byte(src)
+	case nil:
+		*l = SocialLinks{}
+		return nil
+	default:
+		return errors.New("unsupported type of the social links")
+	}
+
+	return json.Unmarshal(content, l)
+}
+
+// ValidateSocialLinks checks the number, the types and the URLs of the links,
+// the errors of a link have the index of the link in the key
+func ValidateSocialLinks(v *validator.Validator, links SocialLinks) {
+	v.Check(len(links) <= 10, "profile_social_links", "must not contain more than 10 links")
+
+	urls := make([]string, len(links))
+	for i, link := range links {
+		key := fmt.Sprintf("profile_social_links.%d", i)
+
+		v.Check(validator.In(link.Type, SocialLinkTypes...), key+".type", "must be a known link type")
+		v.Check(len(link.URL) <= 2048, key+".url", "must not be more than 2048 bytes long")
+		v.Check(validator.IsURL(link.URL), key+".url", "must be an http or https URL")
+
+		urls[i] = link.URL
+	}
+
+	v.Check(validator.Unique(urls), "profile_social_links", "must not contain duplicate URLs")
+}
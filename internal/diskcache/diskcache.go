@@ -0,0 +1,248 @@
+// Package diskcache keeps generated files in a local folder
+// with a limit on the total size.
+package diskcache
+
+import (
+	"container/list"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidKey is returned for a key which is not a plain file name
+var ErrInvalidKey = errors.New("invalid cache key")
+
+// tempPrefix is the prefix of the files which are being written
+const tempPrefix = ".tmp-"
+
+// Cache keeps the files up to MaxBytes, the least recently used files
+// are removed first. Concurrent requests of a missing file are
+// coalesced, so the file is created only once.
+type Cache struct {
+	Dir      string
+	MaxBytes int64
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	size    int64
+	calls   map[string]*call
+}
+
+type entry struct {
+	key  string
+	size int64
+}
+
+// call is a creation of a file which is in progress
+type call struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// New returns a cache in the folder, the files which are already
+// in the folder are kept with the oldest as the least recently used
+func New(dir string, maxBytes int64) (*Cache, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		Dir:      dir,
+		MaxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		calls:    make(map[string]*call),
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []os.FileInfo{}
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		// A temporary file is left over from a crash
+		if strings.HasPrefix(info.Name(), tempPrefix) {
+			os.Remove(filepath.Join(dir, info.Name()))
+			continue
+		}
+
+		files = append(files, info)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, info := range files {
+		c.add(info.Name(), info.Size())
+	}
+	c.evict()
+
+	return c, nil
+}
+
+// Get returns the content of a cached file
+func (c *Cache) Get(key string) ([]byte, bool) {
+	if !validKey(key) {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	element, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(element)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.Dir, key))
+	if err != nil {
+		// The file has been removed outside of the cache
+		c.mu.Lock()
+		c.remove(key)
+		c.mu.Unlock()
+
+		return nil, false
+	}
+
+	return data, true
+}
+
+// Put adds a file to the cache, and removes the least
+// recently used files which are beyond the size limit
+func (c *Cache) Put(key string, data []byte) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	file, err := os.CreateTemp(c.Dir, tempPrefix+key+"-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(c.Dir, key))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(key)
+	c.add(key, int64(len(data)))
+	c.evict()
+
+	return nil
+}
+
+// GetOrCreate returns the cached file, or it creates the file
+// and adds it to the cache. The callers which ask for the same
+// missing file at the same time wait for a single creation.
+func (c *Cache) GetOrCreate(key string, create func() ([]byte, error)) ([]byte, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	data, ok := c.Get(key)
+	if ok {
+		return data, nil
+	}
+
+	c.mu.Lock()
+	if pending, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-pending.done
+		return pending.data, pending.err
+	}
+
+	pending := &call{done: make(chan struct{})}
+	c.calls[key] = pending
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(pending.done)
+	}()
+
+	pending.data, pending.err = create()
+	if pending.err != nil {
+		return nil, pending.err
+	}
+
+	// The file is returned even if it can't be cached
+	_ = c.Put(key, pending.data)
+
+	return pending.data, nil
+}
+
+// Size returns the total size of the cached files
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
+}
+
+// add adds a file as the most recently used one, c.mu has to be held
+func (c *Cache) add(key string, size int64) {
+	c.entries[key] = c.lru.PushFront(&entry{key: key, size: size})
+	c.size += size
+}
+
+// remove removes a file from the index, c.mu has to be held
+func (c *Cache) remove(key string) {
+	element, ok := c.entries[key]
+	if !ok {
+		return
+	}
+
+	c.lru.Remove(element)
+	delete(c.entries, key)
+	c.size -= element.Value.(*entry).size
+}
+
+// evict deletes the least recently used files until the cache
+// is within the size limit, c.mu has to be held
+func (c *Cache) evict() {
+	for c.size > c.MaxBytes && c.lru.Len() > 0 {
+		oldest := c.lru.Back().Value.(*entry)
+		c.remove(oldest.key)
+		os.Remove(filepath.Join(c.Dir, oldest.key))
+	}
+}
+
+// validKey checks that the key is a plain file name in the folder
+func validKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, ".") && filepath.Base(key) == key
+}
@@ -0,0 +1,101 @@
+package diskcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := New(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Put And Get", func(t *testing.T) {
+		err := cache.Put("a", []byte("aaaa"))
+		assert.Nil(t, err)
+
+		data, ok := cache.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, "aaaa", string(data))
+
+		_, ok = cache.Get("missing")
+		assert.False(t, ok)
+	})
+
+	t.Run("Least Recently Used", func(t *testing.T) {
+		err := cache.Put("b", []byte("bbbb"))
+		assert.Nil(t, err)
+
+		// Use "a", so "b" is the least recently used file
+		_, ok := cache.Get("a")
+		assert.True(t, ok)
+
+		err = cache.Put("c", []byte("cccc"))
+		assert.Nil(t, err)
+
+		_, ok = cache.Get("b")
+		assert.False(t, ok)
+		_, ok = cache.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, int64(8), cache.Size())
+	})
+
+	t.Run("Invalid Key", func(t *testing.T) {
+		err := cache.Put("../a", []byte("a"))
+		assert.ErrorIs(t, err, ErrInvalidKey)
+	})
+
+	t.Run("Reopen", func(t *testing.T) {
+		reopened, err := New(dir, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, int64(8), reopened.Size())
+		data, ok := reopened.Get("c")
+		assert.True(t, ok)
+		assert.Equal(t, "cccc", string(data))
+	})
+}
+
+func TestGetOrCreate(t *testing.T) {
+	cache, err := New(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var created int32
+	create := func() ([]byte, error) {
+		atomic.AddInt32(&created, 1)
+		time.Sleep(20 * time.Millisecond)
+		return []byte("resized"), nil
+	}
+
+	// The concurrent requests are coalesced
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			data, err := cache.GetOrCreate("picture_96x96_cover.jpg", create)
+			assert.Nil(t, err)
+			assert.Equal(t, "resized", string(data))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&created))
+
+	// A later request is served from the cache
+	_, err = cache.GetOrCreate("picture_96x96_cover.jpg", create)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&created))
+}
@@ -0,0 +1,218 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Indexer collects the changes of the documents and sends them
+// to Solr in batches. Only the last change of a document is sent,
+// and the changes of a failed batch are sent again with the next one.
+// A document which Solr rejects is dropped with an error.
+type Indexer struct {
+	Solr      *Solr
+	BatchSize int
+	Interval  time.Duration
+
+	mu      sync.Mutex
+	pending map[string]Document
+	full    chan struct{}
+}
+
+// New returns an Indexer which sends a batch every interval,
+// or earlier when the batch size is reached
+func New(solr *Solr, batchSize int, interval time.Duration) *Indexer {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return &Indexer{
+		Solr:      solr,
+		BatchSize: batchSize,
+		Interval:  interval,
+		pending:   make(map[string]Document),
+		full:      make(chan struct{}, 1),
+	}
+}
+
+// Add queues the document to be added or replaced
+func (i *Indexer) Add(doc Document) {
+	id, _ := doc["id"].(string)
+	i.queue(id, doc)
+}
+
+// Delete queues the document to be deleted
+func (i *Indexer) Delete(id string) {
+	i.queue(id, nil)
+}
+
+// queue stores the change, a nil document is a delete
+func (i *Indexer) queue(id string, doc Document) {
+	if id == "" {
+		return
+	}
+
+	i.mu.Lock()
+	i.pending[id] = doc
+	full := len(i.pending) >= i.BatchSize
+	i.mu.Unlock()
+
+	if full {
+		select {
+		case i.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Pending returns the number of the changes which haven't been sent
+func (i *Indexer) Pending() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return len(i.pending)
+}
+
+// Run sends the batches until the quit channel is closed,
+// then it sends the remaining changes. The errors of the batches
+// are passed to the function, the changes are kept for a retry.
+func (i *Indexer) Run(quit <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(i.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			if err := i.Flush(context.Background()); err != nil {
+				onError(err)
+			}
+			return
+		case <-ticker.C:
+		case <-i.full:
+		}
+
+		if err := i.Flush(context.Background()); err != nil {
+			onError(err)
+		}
+	}
+}
+
+// Flush sends the pending changes in batches
+func (i *Indexer) Flush(ctx context.Context) error {
+	for {
+		batch := i.take()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// A batch which Solr rejects is sent again one change at a time,
+		// so only the rejected documents are dropped
+		err := i.send(ctx, batch)
+		var rejected *updateError
+		if errors.As(err, &rejected) {
+			err = i.sendEach(ctx, batch)
+		} else if err != nil {
+			i.restore(batch)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sendEach sends the changes of a batch one by one, it returns an error
+// with the IDs of the documents which Solr has rejected. The remaining
+// changes are queued again if Solr becomes unavailable.
+func (i *Indexer) sendEach(ctx context.Context, batch map[string]Document) error {
+	ids := make([]string, 0, len(batch))
+	for id := range batch {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	dropped := []string{}
+	var lastErr error
+	for n, id := range ids {
+		err := i.send(ctx, map[string]Document{id: batch[id]})
+
+		var rejected *updateError
+		switch {
+		case err == nil:
+		case errors.As(err, &rejected):
+			dropped = append(dropped, id)
+			lastErr = err
+		default:
+			remaining := make(map[string]Document)
+			for _, id := range ids[n:] {
+				remaining[id] = batch[id]
+			}
+			i.restore(remaining)
+			return err
+		}
+	}
+
+	if len(dropped) > 0 {
+		return fmt.Errorf("dropped documents %s: %w", strings.Join(dropped, ", "), lastErr)
+	}
+
+	return nil
+}
+
+// take removes a batch of the changes from the queue
+func (i *Indexer) take() map[string]Document {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	batch := make(map[string]Document)
+	for id, doc := range i.pending {
+		if len(batch) >= i.BatchSize {
+			break
+		}
+		batch[id] = doc
+		delete(i.pending, id)
+	}
+
+	return batch
+}
+
+// restore queues a failed batch again,
+// unless a document has been changed in the meantime
+func (i *Indexer) restore(batch map[string]Document) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for id, doc := range batch {
+		if _, ok := i.pending[id]; !ok {
+			i.pending[id] = doc
+		}
+	}
+}
+
+// send adds and deletes the documents of a batch
+func (i *Indexer) send(ctx context.Context, batch map[string]Document) error {
+	docs := []Document{}
+	ids := []string{}
+	for id, doc := range batch {
+		if doc == nil {
+			ids = append(ids, id)
+		} else {
+			docs = append(docs, doc)
+		}
+	}
+
+	err := i.Solr.Add(ctx, docs)
+	if err != nil {
+		return err
+	}
+
+	return i.Solr.Delete(ctx, ids)
+}
@@ -0,0 +1,197 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSolr is a stand-in of the update handler of a Solr collection,
+// it fails the first requests with the status if it is set
+type fakeSolr struct {
+	mu       sync.Mutex
+	docs     map[string]Document
+	requests int
+	failures int
+	status   int
+}
+
+func newFakeSolr(t *testing.T) (*fakeSolr, *Solr) {
+	fake := &fakeSolr{docs: make(map[string]Document)}
+
+	ts := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	t.Cleanup(ts.Close)
+
+	solr, err := NewSolr(ts.URL+"/solr", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	solr.Backoff = time.Millisecond
+
+	return fake, solr
+}
+
+func (f *fakeSolr) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+
+	if r.Method != http.MethodPost || r.URL.Path != "/solr/profiles/update" {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+
+	// A document with the "invalid" field doesn't match the schema
+	if bytes.Contains(body, []byte(`"invalid"`)) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"msg":"unknown field 'invalid'"}}`)
+		return
+	}
+
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(f.status)
+		io.WriteString(w, `{"error":{"msg":"unavailable"}}`)
+		return
+	}
+
+	// An array adds the documents, an object has the other commands
+	var docs []Document
+	if json.Unmarshal(body, &docs) == nil {
+		for _, doc := range docs {
+			f.docs[doc["id"].(string)] = doc
+		}
+		return
+	}
+
+	var command struct {
+		Delete []string `json:"delete"`
+	}
+	if json.Unmarshal(body, &command) == nil {
+		for _, id := range command.Delete {
+			delete(f.docs, id)
+		}
+	}
+}
+
+func TestSolr(t *testing.T) {
+	t.Run("Retry", func(t *testing.T) {
+		fake, solr := newFakeSolr(t)
+		fake.failures, fake.status = 2, http.StatusServiceUnavailable
+
+		err := solr.Add(context.Background(), []Document{{"id": "1"}})
+		assert.Nil(t, err)
+		assert.Equal(t, 3, fake.requests)
+		assert.Contains(t, fake.docs, "1")
+	})
+
+	t.Run("Retries Exhausted", func(t *testing.T) {
+		fake, solr := newFakeSolr(t)
+		fake.failures, fake.status = 10, http.StatusServiceUnavailable
+
+		err := solr.Add(context.Background(), []Document{{"id": "1"}})
+		assert.EqualError(t, err, "solr: unavailable")
+		assert.Equal(t, solr.Retries+1, fake.requests)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		fake, solr := newFakeSolr(t)
+		fake.failures, fake.status = 1, http.StatusBadRequest
+
+		err := solr.Add(context.Background(), []Document{{"id": "1"}})
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, fake.requests)
+	})
+
+	t.Run("Invalid URL", func(t *testing.T) {
+		_, err := NewSolr("localhost:8983", "profiles")
+		assert.NotNil(t, err)
+
+		_, err = NewSolr("http://localhost:8983/solr", "")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestIndexer(t *testing.T) {
+	t.Run("Batches", func(t *testing.T) {
+		fake, solr := newFakeSolr(t)
+		idx := New(solr, 2, time.Hour)
+
+		idx.Add(Document{"id": "1", "profile_name_t": "John"})
+		idx.Add(Document{"id": "2"})
+		idx.Add(Document{"id": "3"})
+		idx.Add(Document{"id": "1", "profile_name_t": "Jane"})
+		idx.Delete("3")
+
+		err := idx.Flush(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, idx.Pending())
+
+		// Only the last change of a document is sent
+		assert.Len(t, fake.docs, 2)
+		assert.Equal(t, "Jane", fake.docs["1"]["profile_name_t"])
+	})
+
+	t.Run("Failed Batch", func(t *testing.T) {
+		fake, solr := newFakeSolr(t)
+		solr.Retries = 0
+		fake.failures, fake.status = 1, http.StatusServiceUnavailable
+		idx := New(solr, 10, time.Hour)
+
+		idx.Add(Document{"id": "1"})
+		err := idx.Flush(context.Background())
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, idx.Pending())
+
+		err = idx.Flush(context.Background())
+		assert.Nil(t, err)
+		assert.Contains(t, fake.docs, "1")
+	})
+
+	t.Run("Rejected Document", func(t *testing.T) {
+		fake, solr := newFakeSolr(t)
+		idx := New(solr, 10, time.Hour)
+
+		idx.Add(Document{"id": "1"})
+		idx.Add(Document{"id": "2", "invalid": true})
+		idx.Add(Document{"id": "3"})
+
+		// Only the rejected document is dropped
+		err := idx.Flush(context.Background())
+		assert.ErrorContains(t, err, "dropped documents 2")
+		assert.Equal(t, 0, idx.Pending())
+		assert.Len(t, fake.docs, 2)
+		assert.Contains(t, fake.docs, "1")
+		assert.Contains(t, fake.docs, "3")
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		fake, solr := newFakeSolr(t)
+		idx := New(solr, 10, time.Hour)
+
+		quit := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			idx.Run(quit, func(err error) { t.Error(err) })
+			close(done)
+		}()
+
+		// The remaining changes are sent before Run returns
+		idx.Add(Document{"id": "1"})
+		close(quit)
+		<-done
+
+		assert.Contains(t, fake.docs, "1")
+	})
+}
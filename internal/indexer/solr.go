@@ -0,0 +1,167 @@
+// Package indexer keeps a Solr collection in sync with the Profiles,
+// the documents are sent in batches with the JSON update API.
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Document is a Solr document, the keys are the field names
+// and the "id" field is the unique key of the collection
+type Document map[string]interface{}
+
+// Solr is a client of the JSON update API of a Solr collection
+type Solr struct {
+	URL          string
+	Collection   string
+	Client       *http.Client
+	Retries      int
+	Backoff      time.Duration
+	CommitWithin time.Duration
+}
+
+// NewSolr returns a client of the collection on the Solr at the URL,
+// such as http://localhost:8983/solr
+func NewSolr(rawURL string, collection string) (*Solr, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unknown solr URL %q", rawURL)
+	}
+
+	if collection == "" {
+		return nil, errors.New("solr collection must be provided")
+	}
+
+	return &Solr{
+		URL:          strings.TrimSuffix(rawURL, "/"),
+		Collection:   collection,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		Retries:      3,
+		Backoff:      500 * time.Millisecond,
+		CommitWithin: time.Second,
+	}, nil
+}
+
+// Add adds the documents, or replaces the documents with the same ID
+func (s *Solr) Add(ctx context.Context, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	return s.update(ctx, docs)
+}
+
+// Delete deletes the documents by their IDs
+func (s *Solr) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return s.update(ctx, map[string]interface{}{"delete": ids})
+}
+
+// DeleteByQuery deletes the documents which match the query
+func (s *Solr) DeleteByQuery(ctx context.Context, query string) error {
+	return s.update(ctx, map[string]interface{}{"delete": map[string]string{"query": query}})
+}
+
+// Commit makes the changes visible to the searches at once
+func (s *Solr) Commit(ctx context.Context) error {
+	return s.update(ctx, map[string]interface{}{"commit": map[string]string{}})
+}
+
+// update posts a command to the update handler of the collection,
+// and it retries with a growing delay when Solr is unavailable
+func (s *Solr) update(ctx context.Context, command interface{}) error {
+	body, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+
+	endpoint := s.URL + "/" + url.PathEscape(s.Collection) + "/update"
+	if s.CommitWithin > 0 {
+		endpoint += "?commitWithin=" + strconv.FormatInt(s.CommitWithin.Milliseconds(), 10)
+	}
+
+	backoff := s.Backoff
+	for attempt := 0; ; attempt++ {
+		err = s.post(ctx, endpoint, body)
+
+		var permanent *updateError
+		if err == nil || errors.As(err, &permanent) || attempt >= s.Retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends one update request, a client error of Solr
+// is an updateError because a retry can't fix it
+func (s *Solr) post(ctx context.Context, endpoint string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, res.Body)
+		return nil
+	}
+
+	// Solr explains the error in the response
+	var reply struct {
+		Error struct {
+			Msg string `json:"msg"`
+		} `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&reply)
+
+	msg := reply.Error.Msg
+	if msg == "" {
+		msg = res.Status
+	}
+
+	if res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("solr: %s", msg)
+	}
+
+	return &updateError{Status: res.StatusCode, Msg: msg}
+}
+
+// updateError is a rejected update, such as a document
+// with a field which doesn't match the schema
+type updateError struct {
+	Status int
+	Msg    string
+}
+
+func (e *updateError) Error() string {
+	return fmt.Sprintf("solr: %s (status %d)", e.Msg, e.Status)
+}
@@ -0,0 +1,151 @@
+package picture
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	avatarFont     *opentype.Font
+	avatarFontErr  error
+	avatarFontOnce sync.Once
+)
+
+// Initials returns the upper case initials of the first
+// and the last word of a name, for example "JD" for "John Doe"
+func Initials(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	if len(words) == 0 {
+		return "?"
+	}
+
+	initials := []rune{[]rune(words[0])[0]}
+	if len(words) > 1 {
+		initials = append(initials, []rune(words[len(words)-1])[0])
+	}
+
+	return strings.ToUpper(string(initials))
+}
+
+// AvatarColor returns a background color derived from the seed,
+// the same seed always has the same color
+func AvatarColor(seed []byte) color.RGBA {
+	hash := fnv.New32a()
+	hash.Write(seed)
+
+	// Only the hue changes, the saturation and the lightness
+	// are fixed so the white initials stay readable
+	hue := float64(hash.Sum32()%360) / 360
+
+	return hslToRGB(hue, 0.55, 0.45)
+}
+
+// AvatarSVG returns an SVG image with the initials on the background
+func AvatarSVG(initials string, background color.RGBA, size int) []byte {
+	var text bytes.Buffer
+	xml.EscapeText(&text, []byte(initials))
+
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 100 100">`+
+		`<rect width="100" height="100" fill="#%02x%02x%02x"/>`+
+		`<text x="50" y="50" dy="0.35em" text-anchor="middle" font-family="sans-serif" font-weight="bold" font-size="42" fill="#ffffff">%s</text>`+
+		`</svg>`,
+		size, size, background.R, background.G, background.B, text.String()))
+}
+
+// Avatar draws the initials on the background in a square image
+func Avatar(initials string, background color.RGBA, size int) (image.Image, error) {
+	avatarFontOnce.Do(func() {
+		avatarFont, avatarFontErr = opentype.Parse(gobold.TTF)
+	})
+	if avatarFontErr != nil {
+		return nil, avatarFontErr
+	}
+
+	face, err := opentype.NewFace(avatarFont, &opentype.FaceOptions{
+		Size:    float64(size) * 0.42,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	// Center the initials, vertically on the height of the capital letters
+	drawer := &font.Drawer{Dst: img, Src: image.White, Face: face}
+	width := drawer.MeasureString(initials)
+	drawer.Dot = fixed.Point26_6{
+		X: (fixed.I(size) - width) / 2,
+		Y: (fixed.I(size) + face.Metrics().CapHeight) / 2,
+	}
+	drawer.DrawString(initials)
+
+	return img, nil
+}
+
+// placeholderColor is the light gray of the placeholder
+var placeholderColor = color.RGBA{R: 0xe0, G: 0xe0, B: 0xe0, A: 0xff}
+
+// Placeholder returns a plain square image, it is served
+// instead of a picture which can't be shown
+func Placeholder(size int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(placeholderColor), image.Point{}, draw.Src)
+
+	return img
+}
+
+// hslToRGB converts a color from HSL, all the values are from 0 to 1
+func hslToRGB(h, s, l float64) color.RGBA {
+	var q float64
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+
+	channel := func(t float64) uint8 {
+		if t < 0 {
+			t++
+		}
+		if t > 1 {
+			t--
+		}
+
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+
+		return uint8(v*255 + 0.5)
+	}
+
+	return color.RGBA{R: channel(h + 1.0/3), G: channel(h), B: channel(h - 1.0/3), A: 255}
+}
@@ -0,0 +1,209 @@
+package picture
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// The number of the blurhash components, 4 horizontal and 3 vertical
+// components are enough for a placeholder of a portrait or a landscape
+const (
+	blurhashX = 4
+	blurhashY = 3
+)
+
+// metadataSize is the size of the thumbnail which the placeholder
+// metadata is computed from, the details of a bigger image are lost anyway
+const metadataSize = 32
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash returns the blurhash of the image, a short string
+// which a client decodes into a blurred placeholder,
+// see https://github.com/woltapp/blurhash
+func Blurhash(img image.Image) string {
+	thumb := thumbnail(img)
+	bounds := thumb.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// The factors of the cosine transform in linear RGB
+	factors := make([][3]float64, 0, blurhashX*blurhashY)
+	for j := 0; j < blurhashY; j++ {
+		for i := 0; i < blurhashX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1.0
+			}
+
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+
+					c := thumb.RGBAAt(bounds.Min.X+x, bounds.Min.Y+y)
+					factor[0] += basis * srgbToLinear(c.R)
+					factor[1] += basis * srgbToLinear(c.G)
+					factor[2] += basis * srgbToLinear(c.B)
+				}
+			}
+
+			scale := 1.0 / float64(width*height)
+			for k := range factor {
+				factor[k] *= scale
+			}
+			factors = append(factors, factor)
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((blurhashX-1)+(blurhashY-1)*9, 1))
+
+	// Quantise the AC components with the largest one
+	maximum := 0.0
+	for _, factor := range factors[1:] {
+		for _, value := range factor {
+			maximum = math.Max(maximum, math.Abs(value))
+		}
+	}
+
+	acMaximum := 1.0
+	if len(factors) > 1 {
+		quantised := int(math.Max(0, math.Min(82, math.Floor(maximum*166-0.5))))
+		acMaximum = float64(quantised+1) / 166
+		hash.WriteString(encodeBase83(quantised, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encodeBase83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	for _, factor := range factors[1:] {
+		value := 0
+		for k, weight := range []int{19 * 19, 19, 1} {
+			quantised := math.Floor(signPow(factor[k]/acMaximum, 0.5)*9 + 9.5)
+			value += int(math.Max(0, math.Min(18, quantised))) * weight
+		}
+		hash.WriteString(encodeBase83(value, 2))
+	}
+
+	return hash.String()
+}
+
+// DominantColor returns the most common color of the image as a hex
+// string such as "#1e90ff". The colors are grouped in buckets, and the
+// result is the average color of the biggest bucket.
+func DominantColor(img image.Image) string {
+	thumb := thumbnail(img)
+	bounds := thumb.Bounds()
+
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+
+	var dominant *bucket
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := thumb.RGBAAt(x, y)
+
+			// 4 bits of every channel
+			key := int(c.R>>4)<<8 | int(c.G>>4)<<4 | int(c.B>>4)
+			b, ok := buckets[key]
+			if !ok {
+				b = &bucket{}
+				buckets[key] = b
+			}
+
+			b.count++
+			b.r += int(c.R)
+			b.g += int(c.G)
+			b.b += int(c.B)
+
+			if dominant == nil || b.count > dominant.count {
+				dominant = b
+			}
+		}
+	}
+
+	if dominant == nil {
+		return ""
+	}
+
+	return HexColor(color.RGBA{
+		R: uint8(dominant.r / dominant.count),
+		G: uint8(dominant.g / dominant.count),
+		B: uint8(dominant.b / dominant.count),
+		A: 0xff,
+	})
+}
+
+// HexColor returns a color as a hex string such as "#1e90ff"
+func HexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// thumbnail scales the image down for the metadata, with the
+// aspect ratio of the image and the transparency on white
+func thumbnail(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+
+	width, height := metadataSize, metadataSize
+	if bounds.Dx() > bounds.Dy() {
+		height = bounds.Dy() * metadataSize / bounds.Dx()
+	} else {
+		width = bounds.Dx() * metadataSize / bounds.Dy()
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+	return dst
+}
+
+func encodeBase83(value int, length int) string {
+	result := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		result[i] = base83Chars[value%83]
+		value /= 83
+	}
+
+	return string(result)
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
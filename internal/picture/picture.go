@@ -0,0 +1,223 @@
+package picture
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+
+	contentNameRX = regexp.MustCompile(`^[0-9a-f]{64}\.[a-z]+$`)
+	variantNameRX = regexp.MustCompile(`^(.+)_[0-9]+(\.[a-z]+)$`)
+)
+
+// Decode reads a JPEG, PNG, WebP or GIF image, and returns it with the name
+// of the format. The EXIF orientation is applied to the pixels,
+// because the metadata is not kept when the image is encoded again.
+func Decode(data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, "", ErrUnsupportedFormat
+		}
+		return nil, "", err
+	}
+
+	if format == "jpeg" {
+		img = orient(img, orientation(data))
+	}
+
+	// An animated GIF is decoded as its first frame
+	return img, format, nil
+}
+
+// DecodeConfig reads only the format and the dimensions of an image,
+// the dimensions are the ones of the upright image like in Decode
+func DecodeConfig(data []byte) (image.Config, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return image.Config{}, "", ErrUnsupportedFormat
+		}
+		return image.Config{}, "", err
+	}
+
+	// The orientations from 5 to 8 swap the width and the height
+	if format == "jpeg" && orientation(data) >= 5 {
+		config.Width, config.Height = config.Height, config.Width
+	}
+
+	return config, format, nil
+}
+
+// Encode writes the image in the given format, only the pixels
+// are written so the metadata of the upload never reaches the storage
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "jpeg":
+		return jpeg.Encode(w, flatten(img), &jpeg.Options{Quality: 90})
+	case "png":
+		return png.Encode(w, img)
+	default:
+		return ErrUnsupportedFormat
+	}
+}
+
+// Crop returns the part of the image inside the rectangle,
+// the rectangle is relative to the top left corner of the image
+func Crop(img image.Image, rect image.Rectangle) image.Image {
+	rect = rect.Add(img.Bounds().Min).Intersect(img.Bounds())
+
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+
+	return dst
+}
+
+// Square crops the center of the image to a square,
+// and scales it to the size in pixels
+func Square(img image.Image, size int) image.Image {
+	return Resize(img, size, size, FitCover)
+}
+
+// The modes of Resize
+const (
+	// FitCover fills the whole size, the image is cropped
+	// in the center to the aspect ratio of the size
+	FitCover = "cover"
+
+	// FitContain scales the whole image into the size, the result
+	// is smaller than the size if the aspect ratio is different
+	FitContain = "contain"
+)
+
+// IsFit checks if the mode is supported by Resize
+func IsFit(fit string) bool {
+	return fit == FitCover || fit == FitContain
+}
+
+// Resize scales the image to the width and the height in pixels
+func Resize(img image.Image, width int, height int, fit string) image.Image {
+	bounds := img.Bounds()
+	src := bounds
+
+	switch fit {
+	case FitContain:
+		// Keep the aspect ratio of the image
+		if bounds.Dx()*height > bounds.Dy()*width {
+			height = bounds.Dy() * width / bounds.Dx()
+		} else {
+			width = bounds.Dx() * height / bounds.Dy()
+		}
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+	default:
+		// Take the biggest part of the center
+		// with the aspect ratio of the size
+		w, h := bounds.Dx(), bounds.Dy()
+		if w*height > h*width {
+			w = h * width / height
+		} else {
+			h = w * height / width
+		}
+		x := bounds.Min.X + (bounds.Dx()-w)/2
+		y := bounds.Min.Y + (bounds.Dy()-h)/2
+		src = image.Rect(x, y, x+w, y+h)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+
+	return dst
+}
+
+// IsFormat checks if the images can be encoded in the format
+func IsFormat(format string) bool {
+	return format == "jpeg" || format == "png"
+}
+
+// flatten draws the image over a white background,
+// because JPEG doesn't support transparency
+func flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	return dst
+}
+
+// Extension returns the file extension of the format
+func Extension(format string) string {
+	switch format {
+	case "jpeg":
+		return ".jpg"
+	case "png":
+		return ".png"
+	default:
+		return ""
+	}
+}
+
+// NewName returns an unguessable file name for the encoded image.
+// The name is a hash of the content with a random salt, so it can't be
+// derived from the user, and every upload gets a new name.
+func NewName(data []byte, format string) (string, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	hash.Write(salt)
+	hash.Write(data)
+
+	return hex.EncodeToString(hash.Sum(nil)) + Extension(format), nil
+}
+
+// IsContentName checks if the file name has been created by NewName
+func IsContentName(name string) bool {
+	return contentNameRX.MatchString(name)
+}
+
+// VariantName returns the file name of a square variant,
+// for example "picture.jpg" with the size 64 is "picture_64.jpg"
+func VariantName(name string, size int) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), size, ext)
+}
+
+// BaseName returns the name of the picture which a variant belongs to,
+// the name of a picture which is not a variant is returned unchanged
+func BaseName(name string) string {
+	match := variantNameRX.FindStringSubmatch(name)
+	if match == nil {
+		return name
+	}
+
+	return match[1] + match[2]
+}
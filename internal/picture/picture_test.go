@@ -0,0 +1,219 @@
+package picture
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testJPEG returns a 32x16 JPEG image, the left half is red
+// and the right half is blue, with an EXIF orientation tag
+func testJPEG(t *testing.T, orientation uint16) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			if x < 16 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	var buff bytes.Buffer
+	err := jpeg.Encode(&buff, img, &jpeg.Options{Quality: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// TIFF header with a single IFD entry for the orientation
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x002A})
+	binary.Write(&tiff, binary.BigEndian, []uint32{8})
+	binary.Write(&tiff, binary.BigEndian, []uint16{1, 0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, []uint32{1})
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	binary.Write(&tiff, binary.BigEndian, []uint32{0})
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	// Insert the APP1 segment after the Start of Image marker
+	data := buff.Bytes()
+	var out bytes.Buffer
+	out.Write(data[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(data[2:])
+
+	return out.Bytes()
+}
+
+func TestDecodeOrientation(t *testing.T) {
+	tests := []struct {
+		name        string
+		orientation uint16
+		width       int
+		height      int
+		red         image.Point
+	}{
+		{name: "Normal", orientation: 1, width: 32, height: 16, red: image.Pt(4, 8)},
+		{name: "Rotate 180", orientation: 3, width: 32, height: 16, red: image.Pt(28, 8)},
+		{name: "Rotate 90 CW", orientation: 6, width: 16, height: 32, red: image.Pt(8, 4)},
+		{name: "Rotate 90 CCW", orientation: 8, width: 16, height: 32, red: image.Pt(8, 28)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, format, err := Decode(testJPEG(t, tt.orientation))
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			assert.Equal(t, "jpeg", format)
+			assert.Equal(t, tt.width, img.Bounds().Dx())
+			assert.Equal(t, tt.height, img.Bounds().Dy())
+
+			r, _, b, _ := img.At(tt.red.X, tt.red.Y).RGBA()
+			assert.Greater(t, r, b)
+		})
+	}
+}
+
+func TestEncodeStripsMetadata(t *testing.T) {
+	data := testJPEG(t, 6)
+	assert.Contains(t, string(data), "Exif")
+
+	img, format, err := Decode(data)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var buff bytes.Buffer
+	assert.Nil(t, Encode(&buff, img, format))
+	assert.NotContains(t, buff.String(), "Exif")
+}
+
+func TestDecodeFormats(t *testing.T) {
+	// Animated GIF with a red and a blue frame
+	palette := color.Palette{color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}}
+	animation := &gif.GIF{}
+	for i := range palette {
+		frame := image.NewPaletted(image.Rect(0, 0, 8, 8), palette)
+		for p := range frame.Pix {
+			frame.Pix[p] = uint8(i)
+		}
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	var animated bytes.Buffer
+	err := gif.EncodeAll(&animated, animation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lossy 1x1 WebP image
+	lossy, err := base64.StdEncoding.DecodeString("UklGRiIAAABXRUJQVlA4IBYAAAAwAQCdASoBAAEADsD+JaQAA3AAAAAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("GIF", func(t *testing.T) {
+		img, format, err := Decode(animated.Bytes())
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		assert.Equal(t, "gif", format)
+		r, _, b, _ := img.At(4, 4).RGBA()
+		assert.Greater(t, r, b)
+	})
+
+	t.Run("WebP", func(t *testing.T) {
+		img, format, err := Decode(lossy)
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		assert.Equal(t, "webp", format)
+		assert.Equal(t, 1, img.Bounds().Dx())
+
+		var buff bytes.Buffer
+		assert.Nil(t, Encode(&buff, img, "jpeg"))
+	})
+}
+
+func TestAvatar(t *testing.T) {
+	tests := []struct {
+		name     string
+		initials string
+	}{
+		{name: "John Doe", initials: "JD"},
+		{name: "jon", initials: "J"},
+		{name: "Jean-Luc van der Berg", initials: "JB"},
+		{name: "  ", initials: "?"},
+		{name: "émile zola", initials: "ÉZ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.initials, Initials(tt.name))
+		})
+	}
+
+	t.Run("Color", func(t *testing.T) {
+		assert.Equal(t, AvatarColor([]byte("first")), AvatarColor([]byte("first")))
+		assert.NotEqual(t, AvatarColor([]byte("first")), AvatarColor([]byte("second")))
+	})
+
+	t.Run("PNG", func(t *testing.T) {
+		img, err := Avatar("JD", AvatarColor([]byte("first")), 64)
+		assert.Nil(t, err)
+		assert.Equal(t, 64, img.Bounds().Dx())
+	})
+
+	t.Run("SVG", func(t *testing.T) {
+		svg := string(AvatarSVG("<&>", AvatarColor([]byte("first")), 64))
+		assert.Contains(t, svg, "&lt;&amp;&gt;")
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	// A blue picture with a red corner
+	img := image.NewRGBA(image.Rect(0, 0, 60, 40))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{B: 0xff, A: 0xff}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 10, 10), image.NewUniform(color.RGBA{R: 0xff, A: 0xff}), image.Point{}, draw.Src)
+
+	t.Run("Blurhash", func(t *testing.T) {
+		hash := Blurhash(img)
+
+		// The size flag, the maximum, the DC and 11 AC components
+		assert.Len(t, hash, 1+1+4+11*2)
+		assert.Equal(t, "L", hash[:1])
+		assert.Equal(t, hash, Blurhash(img))
+	})
+
+	t.Run("Blurhash Plain", func(t *testing.T) {
+		plain := image.NewRGBA(image.Rect(0, 0, 10, 10))
+		draw.Draw(plain, plain.Bounds(), image.White, image.Point{}, draw.Src)
+
+		// The DC component is the average color
+		assert.Equal(t, encodeBase83(0xffffff, 4), Blurhash(plain)[2:6])
+	})
+
+	t.Run("Dominant Color", func(t *testing.T) {
+		// The scaling blends the colors a little
+		assert.True(t, strings.HasPrefix(DominantColor(img), "#0000f"), DominantColor(img))
+	})
+}
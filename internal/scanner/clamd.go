@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// clamdChunkSize is the size of the chunks of the INSTREAM command,
+// it has to be smaller than the StreamMaxLength of clamd
+const clamdChunkSize = 64 << 10
+
+// Clamd is a client of the ClamAV daemon,
+// the content is sent with the INSTREAM command
+type Clamd struct {
+	Network string
+	Address string
+}
+
+// NewClamd returns a client of the clamd at the address,
+// such as tcp://localhost:3310 or unix:///run/clamav/clamd.ctl
+func NewClamd(address string) (*Clamd, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		return &Clamd{Network: "tcp", Address: u.Host}, nil
+	case "unix":
+		return &Clamd{Network: "unix", Address: u.Path}, nil
+	default:
+		return nil, fmt.Errorf("unknown clamd address %q", address)
+	}
+}
+
+// Scan streams the content to clamd and reads the verdict
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Every chunk is prefixed with the length
+	// and the stream ends with an empty chunk
+	chunk := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk[:4], uint32(n))
+			_, werr := conn.Write(chunk[:4+n])
+			if werr != nil {
+				return nil, werr
+			}
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = conn.Write([]byte{0, 0, 0, 0})
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply parses a reply such as "stream: OK"
+// or "stream: Eicar-Signature FOUND"
+func parseClamdReply(reply string) (*Result, error) {
+	reply = strings.TrimRight(reply, "\x00\n")
+	verdict := strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case verdict == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return &Result{
+			Infected:  true,
+			Signature: strings.TrimSuffix(verdict, " FOUND"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("clamd: %s", reply)
+	}
+}
@@ -0,0 +1,56 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Exec runs a command to scan the content, the content is sent
+// to the standard input. The exit status 0 means the content is clean,
+// and 1 means it is infected with the output as the signature,
+// like clamscan or any script that follows its convention.
+type Exec struct {
+	Command string
+	Args    []string
+}
+
+// NewExec returns a scanner of the command line, such as
+// "clamscan --no-summary -"
+func NewExec(command string) (*Exec, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, errors.New("empty scanner command")
+	}
+
+	return &Exec{Command: fields[0], Args: fields[1:]}, nil
+}
+
+// Scan runs the command with the content
+func (e *Exec) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, e.Command, e.Args...)
+	cmd.Stdin = r
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return &Result{}, nil
+	}
+
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) && exitError.ExitCode() == 1 {
+		return &Result{
+			Infected:  true,
+			Signature: strings.TrimSpace(stdout.String()),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%s: %w: %s", e.Command, err, strings.TrimSpace(stderr.String()))
+}
@@ -0,0 +1,30 @@
+// Package scanner checks the uploaded files for malware
+// and policy violations before they are served.
+package scanner
+
+import (
+	"context"
+	"io"
+)
+
+// Result is the verdict of a scanner on a file
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner is implemented by the content scanners,
+// Scan reads the whole content and returns the verdict.
+// An error means that the content couldn't be checked.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
+
+// Func is an adapter to use a function as a Scanner,
+// it is useful for a fake scanner in the tests
+type Func func(ctx context.Context, r io.Reader) (*Result, error)
+
+// Scan calls the function
+func (f Func) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	return f(ctx, r)
+}
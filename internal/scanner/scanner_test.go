@@ -0,0 +1,166 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClamd serves the INSTREAM command on a local port,
+// the content is infected if it contains "EICAR"
+func fakeClamd(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				command, err := reader.ReadString(0)
+				if err != nil || command != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+
+				var content bytes.Buffer
+				for {
+					var size uint32
+					err := binary.Read(reader, binary.BigEndian, &size)
+					if err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+
+					_, err = io.CopyN(&content, reader, int64(size))
+					if err != nil {
+						return
+					}
+				}
+
+				if bytes.Contains(content.Bytes(), []byte("EICAR")) {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					return
+				}
+				conn.Write([]byte("stream: OK\x00"))
+			}(conn)
+		}
+	}()
+
+	return "tcp://" + listener.Addr().String()
+}
+
+func TestClamd(t *testing.T) {
+	clamd, err := NewClamd(fakeClamd(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name              string
+		content           string
+		expectedInfected  bool
+		expectedSignature string
+	}{
+		{
+			name:    "Clean",
+			content: "profile picture",
+		},
+		{
+			name:              "Infected",
+			content:           "profile EICAR picture",
+			expectedInfected:  true,
+			expectedSignature: "Eicar-Test-Signature",
+		},
+		{
+			name:    "Large",
+			content: strings.Repeat("profile picture ", clamdChunkSize/4),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result, err := clamd.Scan(ctx, strings.NewReader(tt.content))
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tt.expectedInfected, result.Infected)
+			assert.Equal(t, tt.expectedSignature, result.Signature)
+		})
+	}
+
+	t.Run("Error Reply", func(t *testing.T) {
+		_, err := parseClamdReply("INSTREAM size limit exceeded. ERROR\x00")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Invalid Address", func(t *testing.T) {
+		_, err := NewClamd("localhost:3310")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestExec(t *testing.T) {
+	tests := []struct {
+		name              string
+		script            string
+		expectedInfected  bool
+		expectedSignature string
+		expectedError     bool
+	}{
+		{
+			name:   "Clean",
+			script: "cat >/dev/null",
+		},
+		{
+			name:              "Infected",
+			script:            "cat >/dev/null; echo stdin: Eicar FOUND; exit 1",
+			expectedInfected:  true,
+			expectedSignature: "stdin: Eicar FOUND",
+		},
+		{
+			name:          "Failed",
+			script:        "cat >/dev/null; exit 2",
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := &Exec{Command: "sh", Args: []string{"-c", tt.script}}
+
+			result, err := scanner.Scan(context.Background(), strings.NewReader("profile picture"))
+			if tt.expectedError {
+				assert.NotNil(t, err)
+				return
+			}
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tt.expectedInfected, result.Infected)
+			assert.Equal(t, tt.expectedSignature, result.Signature)
+		})
+	}
+}
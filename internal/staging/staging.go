@@ -0,0 +1,333 @@
+package staging
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound       = errors.New("upload session not found")
+	ErrOffsetConflict = errors.New("upload offset conflict")
+	ErrTooLarge       = errors.New("upload is larger than its size")
+	ErrTooMany        = errors.New("too many upload sessions")
+)
+
+// Session is a resumable upload, the data is appended in chunks
+// until the offset reaches the size of the upload
+type Session struct {
+	ID        uuid.UUID `json:"id"`
+	User      uuid.UUID `json:"-"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Complete checks if all the data of the upload has been received
+func (s *Session) Complete() bool {
+	return s.Offset == s.Size
+}
+
+// session is the metadata of a Session as it is saved on the disk
+type session struct {
+	ID        uuid.UUID `json:"id"`
+	User      uuid.UUID `json:"user"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Staging keeps the partial data of the resumable uploads in a folder,
+// every session has a metadata file and a data file. A user can't have
+// more than MaxSessions active sessions, zero is no limit.
+type Staging struct {
+	Dir         string
+	TTL         time.Duration
+	MaxSessions int
+
+	locks    sync.Map
+	createMu sync.Mutex
+}
+
+// New creates the staging folder if it doesn't already exist
+func New(dir string, ttl time.Duration) (*Staging, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Staging{Dir: dir, TTL: ttl}, nil
+}
+
+func (s *Staging) metaPath(id uuid.UUID) string {
+	return filepath.Join(s.Dir, id.String()+".json")
+}
+
+func (s *Staging) dataPath(id uuid.UUID) string {
+	return filepath.Join(s.Dir, id.String()+".part")
+}
+
+// lock serializes the writes to a single session
+func (s *Staging) lock(id uuid.UUID) func() {
+	mu, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+
+	return mu.(*sync.Mutex).Unlock
+}
+
+// Create starts a new upload of the user with the total size in bytes,
+// it returns ErrTooMany if the user has reached the limit of the sessions
+func (s *Staging) Create(user uuid.UUID, size int64) (*Session, error) {
+	// The sessions are counted and created one at a time,
+	// so the concurrent requests can't pass the limit
+	s.createMu.Lock()
+	defer s.createMu.Unlock()
+
+	if s.MaxSessions > 0 {
+		sessions, err := s.list()
+		if err != nil {
+			return nil, err
+		}
+
+		active := 0
+		for _, session := range sessions {
+			if session.User == user {
+				active++
+			}
+		}
+
+		if active >= s.MaxSessions {
+			return nil, ErrTooMany
+		}
+	}
+
+	now := time.Now()
+	meta := session{
+		ID:        uuid.New(),
+		User:      user,
+		Size:      size,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.TTL),
+	}
+
+	js, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the data file first, a session
+	// without a metadata file is never read
+	err = os.WriteFile(s.dataPath(meta.ID), nil, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(s.metaPath(meta.ID), js, 0o644)
+	if err != nil {
+		os.Remove(s.dataPath(meta.ID))
+		return nil, err
+	}
+
+	return meta.session(0), nil
+}
+
+// Get returns the session with the current offset,
+// an expired session is not found
+func (s *Staging) Get(id uuid.UUID) (*Session, error) {
+	js, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var meta session
+	err = json.Unmarshal(js, &meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(meta.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+
+	stat, err := os.Stat(s.dataPath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return meta.session(stat.Size()), nil
+}
+
+// Append writes a chunk at the offset, which has to be the current offset
+// of the session, and returns the session with the new offset. The chunk
+// can't make the upload larger than its size.
+func (s *Staging) Append(id uuid.UUID, offset int64, chunk io.Reader) (*Session, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	current, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset != current.Offset {
+		return current, ErrOffsetConflict
+	}
+
+	file, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Read one more byte than the space left to find a chunk which is too large
+	left := current.Size - current.Offset
+	n, err := io.Copy(file, io.LimitReader(chunk, left+1))
+	if n > left {
+		file.Truncate(current.Offset)
+		return current, ErrTooLarge
+	}
+	if err != nil {
+		// Keep what has been received, the client
+		// resumes from the offset of the session
+		file.Close()
+		if session, getErr := s.Get(id); getErr == nil {
+			return session, err
+		}
+		return nil, err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	current.Offset += n
+
+	return current, nil
+}
+
+// Read returns the data of a complete upload
+func (s *Staging) Read(id uuid.UUID) ([]byte, error) {
+	buff, err := os.ReadFile(s.dataPath(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return buff, nil
+}
+
+// Delete removes the session with its data
+func (s *Staging) Delete(id uuid.UUID) error {
+	unlock := s.lock(id)
+	defer unlock()
+	defer s.locks.Delete(id)
+
+	for _, path := range []string{s.metaPath(id), s.dataPath(id)} {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Cleanup removes the expired sessions, and returns how many were removed
+func (s *Staging) Cleanup() (int, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, id := range ids {
+		_, err = s.Get(id)
+		if !errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		err = s.Delete(id)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// list returns the active sessions
+func (s *Staging) list() ([]*Session, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []*Session{}
+	for _, id := range ids {
+		session, err := s.Get(id)
+		if err != nil {
+			// An expired session is removed by Cleanup
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// ids returns the IDs of the sessions which have a metadata file
+func (s *Staging) ids() ([]uuid.UUID, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []uuid.UUID{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		id, err := uuid.Parse(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func (m session) session(offset int64) *Session {
+	return &Session{
+		ID:        m.ID,
+		User:      m.User,
+		Size:      m.Size,
+		Offset:    offset,
+		CreatedAt: m.CreatedAt,
+		ExpiresAt: m.ExpiresAt,
+	}
+}
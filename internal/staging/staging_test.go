@@ -0,0 +1,119 @@
+package staging
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStaging(t *testing.T) *Staging {
+	stage, err := New(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stage
+}
+
+func TestAppend(t *testing.T) {
+	stage := testStaging(t)
+	user := uuid.New()
+
+	session, err := stage.Create(user, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Chunk", func(t *testing.T) {
+		current, err := stage.Append(session.ID, 0, strings.NewReader("hello"))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(5), current.Offset)
+		assert.False(t, current.Complete())
+	})
+
+	t.Run("Offset Conflict", func(t *testing.T) {
+		current, err := stage.Append(session.ID, 0, strings.NewReader("hello"))
+		assert.ErrorIs(t, err, ErrOffsetConflict)
+		assert.Equal(t, int64(5), current.Offset)
+	})
+
+	t.Run("Too Large", func(t *testing.T) {
+		current, err := stage.Append(session.ID, 5, strings.NewReader("world!"))
+		assert.ErrorIs(t, err, ErrTooLarge)
+		assert.Equal(t, int64(5), current.Offset)
+
+		// The rejected chunk is not kept
+		current, err = stage.Get(session.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(5), current.Offset)
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		current, err := stage.Append(session.ID, 5, strings.NewReader("world"))
+		assert.Nil(t, err)
+		assert.True(t, current.Complete())
+
+		content, err := stage.Read(session.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "helloworld", string(content))
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := stage.Append(uuid.New(), 0, strings.NewReader("hello"))
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestCleanup(t *testing.T) {
+	stage := testStaging(t)
+	user := uuid.New()
+
+	active, err := stage.Create(user, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A session created with a negative lifetime has expired
+	stage.TTL = -time.Minute
+	expired, err := stage.Create(user, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := stage.Cleanup()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+
+	_, err = stage.Get(active.ID)
+	assert.Nil(t, err)
+
+	_, err = stage.Read(expired.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMaxSessions(t *testing.T) {
+	stage := testStaging(t)
+	stage.MaxSessions = 2
+	user := uuid.New()
+
+	first, err := stage.Create(user, 10)
+	assert.Nil(t, err)
+	_, err = stage.Create(user, 10)
+	assert.Nil(t, err)
+
+	_, err = stage.Create(user, 10)
+	assert.ErrorIs(t, err, ErrTooMany)
+
+	// The limit is per user
+	_, err = stage.Create(uuid.New(), 10)
+	assert.Nil(t, err)
+
+	// A finished session frees a place
+	err = stage.Delete(first.ID)
+	assert.Nil(t, err)
+	_, err = stage.Create(user, 10)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tempPrefix starts the names of the files which are still written
+const tempPrefix = ".tmp-"
+
+// Local stores the files in a folder of the local filesystem
+type Local struct {
+	Dir string
+}
+
+// NewLocal creates the folder if it doesn't already exist
+func NewLocal(dir string) (*Local, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{Dir: dir}, nil
+}
+
+// path returns the location of the file on the disk, a name can't
+// point outside of the folder or to a hidden temporary file
+func (s *Local) path(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || filepath.Base(name) != name {
+		return "", ErrInvalidName
+	}
+
+	return filepath.Join(s.Dir, name), nil
+}
+
+func (s *Local) Put(name string, r io.Reader, size int64) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	// Write the content to a temporary file in the same folder,
+	// and rename it when it is complete, so a reader never sees
+	// a partial file and a failed write doesn't replace a file
+	tmp, err := os.CreateTemp(s.Dir, tempPrefix+name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Local) Get(name string) (io.ReadSeekCloser, *FileInfo, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, localError(err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return file, fileInfo(stat), nil
+}
+
+func (s *Local) Stat(name string) (*FileInfo, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, localError(err)
+	}
+
+	return fileInfo(stat), nil
+}
+
+func (s *Local) Delete(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Local) List() ([]FileInfo, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []FileInfo{}
+	for _, entry := range entries {
+		// Folders and unfinished files are not part of the store
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), tempPrefix) {
+			continue
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			// The file has been removed after reading the folder
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		files = append(files, *fileInfo(stat))
+	}
+
+	return files, nil
+}
+
+// CleanupTemp removes the temporary files which have been left
+// by a crash in the middle of a write
+func (s *Local) CleanupTemp(before time.Time) (int, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasPrefix(entry.Name(), tempPrefix) {
+			continue
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return removed, err
+		}
+
+		// A recent file may be written right now
+		if stat.ModTime().After(before) {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(s.Dir, entry.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+func fileInfo(stat fs.FileInfo) *FileInfo {
+	return &FileInfo{
+		Name:    stat.Name(),
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+		ETag:    fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size()),
+	}
+}
+
+func localError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+
+	return err
+}
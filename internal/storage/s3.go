@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores the files in a bucket of an S3-compatible service,
+// such as AWS S3 or MinIO
+type S3 struct {
+	Client *minio.Client
+	Bucket string
+}
+
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+// NewS3 connects to the service and creates the bucket
+// if it doesn't already exist
+func NewS3(cfg S3Config) (*S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		err = client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3{Client: client, Bucket: cfg.Bucket}, nil
+}
+
+func (s *S3) Put(name string, r io.Reader, size int64) error {
+	if name == "" {
+		return ErrInvalidName
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := s.Client.PutObject(ctx, s.Bucket, name, r, size, minio.PutObjectOptions{})
+	return err
+}
+
+func (s *S3) Get(name string) (io.ReadSeekCloser, *FileInfo, error) {
+	if name == "" {
+		return nil, nil, ErrInvalidName
+	}
+
+	// The object is read lazily while it is streamed to the client,
+	// so a timeout here would cut off a slow download
+	object, err := s.Client.GetObject(context.Background(), s.Bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s3Error(err)
+	}
+
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, nil, s3Error(err)
+	}
+
+	return object, s3FileInfo(info), nil
+}
+
+func (s *S3) Stat(name string) (*FileInfo, error) {
+	if name == "" {
+		return nil, ErrInvalidName
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := s.Client.StatObject(ctx, s.Bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	return s3FileInfo(info), nil
+}
+
+func (s *S3) Delete(name string) error {
+	if name == "" {
+		return ErrInvalidName
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.Client.RemoveObject(ctx, s.Bucket, name, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) List() ([]FileInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	files := []FileInfo{}
+	for info := range s.Client.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+
+		files = append(files, *s3FileInfo(info))
+	}
+
+	return files, nil
+}
+
+func s3FileInfo(info minio.ObjectInfo) *FileInfo {
+	return &FileInfo{
+		Name:    info.Key,
+		Size:    info.Size,
+		ModTime: info.LastModified,
+		ETag:    info.ETag,
+	}
+}
+
+func s3Error(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket":
+		return ErrNotFound
+	default:
+		return err
+	}
+}
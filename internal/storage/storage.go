@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("file not found")
+	ErrInvalidName = errors.New("invalid file name")
+)
+
+// Storage is a flat blob store for the uploaded files,
+// every file is addressed only by its name.
+// Get and Stat return ErrNotFound for a missing file,
+// but Delete of a missing file is not an error.
+type Storage interface {
+	Put(name string, r io.Reader, size int64) error
+	Get(name string) (io.ReadSeekCloser, *FileInfo, error)
+	Stat(name string) (*FileInfo, error)
+	Delete(name string) error
+	List() ([]FileInfo, error)
+}
+
+// FileInfo describes a stored file, ETag is an opaque
+// version of the content without the surrounding quotes
+type FileInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	ETag    string
+}
+
+// TempCleaner is implemented by the stores which write the content
+// to a temporary file first. CleanupTemp removes the temporary files
+// of the interrupted writes which are older than the time.
+type TempCleaner interface {
+	CleanupTemp(before time.Time) (int, error)
+}
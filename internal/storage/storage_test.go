@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStorage(t, store)
+
+	t.Run("Invalid Name", func(t *testing.T) {
+		_, _, err := store.Get("../profile.jpg")
+		assert.ErrorIs(t, err, ErrInvalidName)
+	})
+
+	t.Run("Cleanup Temp", func(t *testing.T) {
+		// The temporary files of a crash are not listed
+		old := filepath.Join(store.Dir, tempPrefix+"old.jpg-1")
+		recent := filepath.Join(store.Dir, tempPrefix+"recent.jpg-2")
+		for _, path := range []string{old, recent} {
+			err := os.WriteFile(path, []byte("partial"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := os.Chtimes(old, time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		removed, err := store.CleanupTemp(time.Now().Add(-time.Hour))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, removed)
+
+		_, err = os.Stat(old)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		_, err = os.Stat(recent)
+		assert.Nil(t, err)
+	})
+}
+
+// TestS3 runs against a MinIO container from docker-compose.test.yml,
+// and it is skipped if the endpoint is not set
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("S3ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3ENDPOINT is not set")
+	}
+
+	store, err := NewS3(S3Config{
+		Endpoint:  endpoint,
+		AccessKey: os.Getenv("S3ACCESSKEY"),
+		SecretKey: os.Getenv("S3SECRETKEY"),
+		Bucket:    "profiles-test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStorage(t, store)
+}
+
+func testStorage(t *testing.T, store Storage) {
+	content := []byte("profile picture")
+
+	t.Run("Put", func(t *testing.T) {
+		err := store.Put("profile.jpg", bytes.NewReader(content), int64(len(content)))
+		assert.Nil(t, err)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		file, info, err := store.Get("profile.jpg")
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer file.Close()
+
+		body, err := io.ReadAll(file)
+		assert.Nil(t, err)
+		assert.Equal(t, content, body)
+		assert.Equal(t, int64(len(content)), info.Size)
+		assert.NotEmpty(t, info.ETag)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		files, err := store.List()
+		assert.Nil(t, err)
+		assert.Len(t, files, 1)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.Nil(t, store.Delete("profile.jpg"))
+		assert.Nil(t, store.Delete("profile.jpg"))
+
+		_, err := store.Stat("profile.jpg")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"net/url"
 	"regexp"
 )
 
@@ -54,3 +55,13 @@ func Unique(values []string) bool {
 
 	return len(values) == len(uniqueValues)
 }
+
+// IsURL checks if the value is an absolute http or https URL
+func IsURL(value string) bool {
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1 @@
+ALTER TABLE profiles DROP COLUMN IF EXISTS profile_picture_status_s;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_picture_status_s char varying(16) NOT NULL DEFAULT 'approved';
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS picture_history;
\ No newline at end of file
@@ -0,0 +1,11 @@
+-- The history is ordered by the creation time, so it has the full precision
+CREATE TABLE IF NOT EXISTS picture_history (
+    id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+    created_at_dt timestamp with time zone NOT NULL DEFAULT NOW(),
+    history_profile_s UUID NOT NULL REFERENCES profiles (id) ON DELETE CASCADE,
+    history_picture_s char varying(512) NOT NULL,
+    history_picture_status_s char varying(16) NOT NULL DEFAULT 'approved',
+    UNIQUE (history_profile_s, history_picture_s)
+);
+
+CREATE INDEX IF NOT EXISTS picture_history_profile_idx ON picture_history (history_profile_s, created_at_dt DESC);
\ No newline at end of file
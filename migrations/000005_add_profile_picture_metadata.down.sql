@@ -0,0 +1,2 @@
+ALTER TABLE profiles DROP COLUMN IF EXISTS profile_picture_blurhash_s;
+ALTER TABLE profiles DROP COLUMN IF EXISTS profile_picture_color_s;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_picture_blurhash_s char varying(64) NOT NULL DEFAULT '';
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_picture_color_s char varying(7) NOT NULL DEFAULT '';
\ No newline at end of file
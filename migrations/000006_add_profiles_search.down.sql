@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS profiles_profile_name_t_trgm_idx;
+DROP INDEX IF EXISTS profiles_profile_search_tsv_idx;
+ALTER TABLE profiles DROP COLUMN IF EXISTS profile_search_tsv;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_search_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', coalesce(profile_name_t, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS profiles_profile_search_tsv_idx ON profiles USING GIN (profile_search_tsv);
+CREATE INDEX IF NOT EXISTS profiles_profile_name_t_trgm_idx ON profiles USING GIN (profile_name_t gin_trgm_ops);
\ No newline at end of file
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS profiles_profile_search_tsv_idx;
+ALTER TABLE profiles DROP COLUMN IF EXISTS profile_search_tsv;
+ALTER TABLE profiles ADD COLUMN profile_search_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', coalesce(profile_name_t, ''))) STORED;
+CREATE INDEX IF NOT EXISTS profiles_profile_search_tsv_idx ON profiles USING GIN (profile_search_tsv);
+
+ALTER TABLE profiles DROP COLUMN IF EXISTS profile_social_links;
+ALTER TABLE profiles DROP COLUMN IF EXISTS profile_website_s;
+ALTER TABLE profiles DROP COLUMN IF EXISTS profile_location_t;
+ALTER TABLE profiles DROP COLUMN IF EXISTS profile_bio_t;
+ALTER TABLE profiles DROP COLUMN IF EXISTS profile_headline_t;
\ No newline at end of file
@@ -0,0 +1,17 @@
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_headline_t char varying(120) NOT NULL DEFAULT '';
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_bio_t text NOT NULL DEFAULT '';
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_location_t char varying(100) NOT NULL DEFAULT '';
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_website_s char varying(2048) NOT NULL DEFAULT '';
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS profile_social_links jsonb NOT NULL DEFAULT '[]';
+
+-- The search covers the new text fields, the name has the highest weight
+DROP INDEX IF EXISTS profiles_profile_search_tsv_idx;
+ALTER TABLE profiles DROP COLUMN IF EXISTS profile_search_tsv;
+ALTER TABLE profiles ADD COLUMN profile_search_tsv tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(profile_name_t, '')), 'A') ||
+        setweight(to_tsvector('simple', profile_headline_t), 'B') ||
+        setweight(to_tsvector('simple', profile_location_t), 'C') ||
+        setweight(to_tsvector('simple', profile_bio_t), 'D')
+    ) STORED;
+CREATE INDEX IF NOT EXISTS profiles_profile_search_tsv_idx ON profiles USING GIN (profile_search_tsv);
\ No newline at end of file
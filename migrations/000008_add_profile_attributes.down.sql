@@ -0,0 +1 @@
+ALTER TABLE profiles DROP COLUMN IF EXISTS attributes;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS attributes jsonb NOT NULL DEFAULT '{}';
\ No newline at end of file